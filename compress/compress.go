@@ -0,0 +1,168 @@
+package compress
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/harnash/go-middlewares"
+)
+
+// DefaultMinSize is the minimum size of the response body in bytes worth encoding
+const DefaultMinSize = 1024
+
+// DefaultContentTypes lists the media types encoded by default. Patterns ending with "/*" match all the subtypes.
+var DefaultContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/ld+json",
+	"application/manifest+json",
+	"application/javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+type options struct {
+	encodings    []string
+	levels       map[string]int
+	minSize      int
+	contentTypes []string
+
+	metrics         DecompressionMetrics
+	name            string
+	maxDecompressed int64
+}
+
+// Option represents a compression option. Options regarding the request bodies are used only by Decompressed, options
+// regarding the responses only by Compressed.
+type Option func(*options)
+
+// WithEncodings sets the supported encodings in the order of preference (see: DefaultEncodings). Decompressed
+// accepts request bodies encoded with any of them.
+func WithEncodings(encodings ...string) Option {
+	return func(o *options) {
+		o.encodings = encodings
+	}
+}
+
+// WithLevel sets the compression level of the encoding (levels of the compress/flate package for gzip and deflate,
+// 0-11 for brotli and zstd levels for zstd)
+func WithLevel(encoding string, level int) Option {
+	return func(o *options) {
+		o.levels[encoding] = level
+	}
+}
+
+// WithMinSize sets the minimum size of the response body in bytes worth encoding (DefaultMinSize by default).
+// Streamed (flushed) responses are encoded regardless of their size.
+func WithMinSize(size int) Option {
+	return func(o *options) {
+		o.minSize = size
+	}
+}
+
+// WithContentTypes sets the media types of responses to be encoded (DefaultContentTypes by default)
+func WithContentTypes(contentTypes ...string) Option {
+	return func(o *options) {
+		o.contentTypes = contentTypes
+	}
+}
+
+// WithMetrics sets custom metric collector/container for decompression metrics
+func WithMetrics(metrics DecompressionMetrics) Option {
+	return func(o *options) {
+		o.metrics = metrics
+	}
+}
+
+// WithName sets the name of the handler used in decompression metrics ("default" by default)
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithMaxDecompressedSize sets the limit of the decompressed request body in bytes (DefaultMaxDecompressedSize by
+// default). Zero disables the limit.
+func WithMaxDecompressedSize(size int64) Option {
+	return func(o *options) {
+		o.maxDecompressed = size
+	}
+}
+
+// newOptions takes functional options and returns options.
+func newOptions(opts ...Option) *options {
+	cfg := &options{
+		encodings:    DefaultEncodings,
+		levels:       map[string]int{},
+		minSize:      DefaultMinSize,
+		contentTypes: DefaultContentTypes,
+
+		metrics:         basicMetrics,
+		name:            "default",
+		maxDecompressed: DefaultMaxDecompressedSize,
+	}
+	for encoding, level := range defaultLevels {
+		cfg.levels[encoding] = level
+	}
+
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	return cfg
+}
+
+// allowedType reports if the media type of the Content-Type header matches any of the patterns
+func allowedType(contentType string, patterns []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Compressed will encode responses with the best encoding accepted by the client (Accept-Encoding header with
+// q-values). Responses smaller than the minimum size, with media types outside the allowlist or already encoded by the
+// handler are sent as is. Encoders are pooled. Flushes of streamed responses are passed through the encoder. Sizes of
+// the body before and after encoding are reported to logging.AccessLog and http_metrics.Measured placed before this
+// middleware. Compressed panics if the encodings or levels are invalid.
+func Compressed(options ...Option) middlewares.Middleware {
+	o := newOptions(options...)
+	pools := make(map[string]*encoderPool, len(o.encodings))
+	for _, encoding := range o.encodings {
+		pool, err := newEncoderPool(encoding, o.levels[encoding])
+		if err != nil {
+			panic(err)
+		}
+		pools[encoding] = pool
+	}
+
+	fn := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := negotiate(r.Header.Get("Accept-Encoding"), o.encodings)
+			cw := &compressWriter{ResponseWriter: w, request: r, options: o, encoding: encoding, pool: pools[encoding]}
+			h.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+
+	return fn
+}
@@ -0,0 +1,92 @@
+package compress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/harnash/go-middlewares/http_metrics"
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAllowedType(t *testing.T) {
+	patterns := []string{"text/*", "application/json"}
+	assert.True(t, allowedType("text/html; charset=utf-8", patterns), "subtype should match")
+	assert.True(t, allowedType("Application/JSON", patterns), "media type should be case insensitive")
+	assert.False(t, allowedType("application/json-seq", patterns), "media type should match exactly")
+	assert.False(t, allowedType("textual/plain", patterns), "type should match exactly")
+	assert.False(t, allowedType("", patterns), "empty media type should not match")
+}
+
+func TestCompressed(t *testing.T) {
+	assert.Panics(t, func() { Compressed(WithLevel(Gzip, 42)) }, "invalid level should panic")
+	assert.Panics(t, func() { Compressed(WithEncodings("compress")) }, "unsupported encoding should panic")
+
+	payload := strings.Repeat("compress me ", 200)
+	handler := Compressed(WithEncodings(Gzip, Deflate), WithLevel(Gzip, 9))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(payload))
+		}))
+
+	for _, encoding := range []string{Gzip, Deflate} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", "br, zstd, "+encoding)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		assert.Equal(t, encoding, rec.Header().Get("Content-Encoding"), "only configured encodings should be used")
+		assert.Equal(t, payload, decode(t, encoding, rec.Body.Bytes()), "invalid body")
+	}
+}
+
+func TestCompressedSizes(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := http_metrics.NewMetrics(registry, http_metrics.WithBuckets(
+		http_metrics.UncompressedResponseSizeHistogram, []float64{1000, 10000}))
+	assert.NoError(t, err, "could not create http metrics")
+
+	logWatcher, logs := observer.New(zapcore.DebugLevel)
+	customLog := logging.LogGetter(func() (*zap.SugaredLogger, error) {
+		return zap.New(logWatcher).Sugar(), nil
+	})
+
+	payload := strings.Repeat("compress me ", 200)
+	handler := logging.InContext(logging.WithLogger(customLog))(
+		http_metrics.Measured(http_metrics.WithName("api"), http_metrics.WithMetrics(metrics))(
+			logging.AccessLog()(
+				Compressed()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "text/plain")
+					_, _ = w.Write([]byte(payload))
+				})))))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, Gzip, rec.Header().Get("Content-Encoding"), "response not encoded")
+
+	responses := logs.FilterMessage("response generated").All()
+	if assert.Len(t, responses, 1, "response not logged") {
+		fields := responses[0].ContextMap()
+		assert.Equal(t, Gzip, fields["content_encoding"], "encoding not logged")
+		assert.Equal(t, int64(len(payload)), fields["response_size_uncompressed"], "uncompressed size not logged")
+		assert.Equal(t, int64(rec.Body.Len()), fields["response_size"], "compressed size not logged")
+	}
+
+	body := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, body, `http_response_uncompressed_size_bytes_sum{code="200",method="get"} 2400`,
+		"uncompressed size not measured")
+	assert.Contains(t, body, `http_response_uncompressed_size_bytes_bucket{code="200",method="get",le="1000"} 0`,
+		"uncompressed size not measured")
+	assert.Contains(t, body, `http_response_size_bytes_sum{code="200",method="get"} `+strconv.Itoa(rec.Body.Len()),
+		"compressed size not measured")
+}
@@ -0,0 +1,320 @@
+package compress
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/harnash/go-middlewares"
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultMaxDecompressedSize is the default limit of the decompressed request body in bytes
+const DefaultMaxDecompressedSize = 10 << 20
+
+// maxRequestEncodings limits the number of stacked content codings of the request body, each of them needs a decoder
+const maxRequestEncodings = 2
+
+// maxZstdWindow limits the memory used by zstd decoders (the limit of the web browsers)
+const maxZstdWindow = 8 << 20
+
+// Reasons of failed decompression used in logs and metrics
+const (
+	ReasonUnsupported = "unsupported"
+	ReasonMalformed   = "malformed"
+	ReasonTooLarge    = "too_large"
+)
+
+var (
+	gzipDecoders   = sync.Pool{New: func() any { return new(gzip.Reader) }}
+	brotliDecoders = sync.Pool{New: func() any { return brotli.NewReader(nil) }}
+	zstdDecoders   = sync.Pool{New: func() any {
+		// options are valid so the decoder is always created
+		d, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxZstdWindow))
+		return d
+	}}
+)
+
+// newDecoder returns the reader decoding the content encoding of r and the function releasing the decoder
+func newDecoder(encoding string, r io.Reader) (io.Reader, func(), error) {
+	switch encoding {
+	case Gzip:
+		d := gzipDecoders.Get().(*gzip.Reader)
+		if err := d.Reset(r); err != nil {
+			gzipDecoders.Put(d)
+			return nil, nil, err
+		}
+		return d, func() { gzipDecoders.Put(d) }, nil
+	case Deflate:
+		d, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return d, func() {}, nil
+	case Brotli:
+		d := brotliDecoders.Get().(*brotli.Reader)
+		_ = d.Reset(r)
+		return d, func() { brotliDecoders.Put(d) }, nil
+	case Zstd:
+		d := zstdDecoders.Get().(*zstd.Decoder)
+		if err := d.Reset(r); err != nil {
+			zstdDecoders.Put(d)
+			return nil, nil, err
+		}
+		return d, func() {
+			// do not hold the reference to the request body
+			_ = d.Reset(nil)
+			zstdDecoders.Put(d)
+		}, nil
+	default:
+		return nil, nil, fmt.Errorf("compress: unsupported encoding: %s", encoding)
+	}
+}
+
+// requestEncodings parses the Content-Encoding header of the request into the list of codings in the order they
+// were applied. Unsupported coding is returned separately.
+func requestEncodings(header string, supported []string) ([]string, string) {
+	var encodings []string
+	for _, part := range strings.Split(header, ",") {
+		encoding := strings.ToLower(strings.TrimSpace(part))
+		if encoding == "x-gzip" {
+			encoding = Gzip
+		}
+		if len(encoding) == 0 || encoding == Identity {
+			continue
+		}
+
+		found := false
+		for _, s := range supported {
+			if s == encoding {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, encoding
+		}
+		encodings = append(encodings, encoding)
+	}
+
+	return encodings, ""
+}
+
+// countingReader counts the bytes read and remembers the last error
+type countingReader struct {
+	r    io.Reader
+	read int64
+	err  error
+}
+
+// Read implements io.Reader interface
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	c.err = err
+	return n, err
+}
+
+// decodedBody is the request body with the content encoding removed
+type decodedBody struct {
+	io.Reader
+	body         io.Closer
+	compressed   *countingReader
+	decompressed int64
+	failure      string
+	err          error
+}
+
+// Read implements io.Reader interface
+func (b *decodedBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.decompressed += int64(n)
+
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case err == nil, err == io.EOF, len(b.failure) > 0:
+	case errors.As(err, &maxBytesErr):
+		b.failure, b.err = ReasonTooLarge, err
+	case err != b.compressed.err:
+		// errors of the body itself (eg. client disconnects) are not decoding failures
+		b.failure, b.err = ReasonMalformed, err
+	}
+
+	return n, err
+}
+
+// Close implements io.Closer interface
+func (b *decodedBody) Close() error {
+	return b.body.Close()
+}
+
+// DecompressionMetrics defines interface for custom metric collector/container
+type DecompressionMetrics interface {
+	prometheus.Collector
+	GetCompressedSize() *prometheus.HistogramVec
+	GetDecompressedSize() *prometheus.HistogramVec
+	GetFailures() *prometheus.CounterVec
+}
+
+// defaultMetrics holds all the metrics of decompressed request bodies
+type defaultMetrics struct {
+	compressed   *prometheus.HistogramVec
+	decompressed *prometheus.HistogramVec
+	failures     *prometheus.CounterVec
+}
+
+var basicMetrics = newDefaultMetrics()
+
+// GetCompressedSize return metric that measures the size of encoded request bodies
+func (s defaultMetrics) GetCompressedSize() *prometheus.HistogramVec {
+	return s.compressed
+}
+
+// GetDecompressedSize return metric that measures the size of request bodies after decoding
+func (s defaultMetrics) GetDecompressedSize() *prometheus.HistogramVec {
+	return s.decompressed
+}
+
+// GetFailures return metric that counts request bodies which could not be decoded per reason
+func (s defaultMetrics) GetFailures() *prometheus.CounterVec {
+	return s.failures
+}
+
+// newDefaultMetrics creates new decompression metrics
+func newDefaultMetrics() DecompressionMetrics {
+	compressed := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_compressed_size_bytes",
+		Help:    "size of the encoded request bodies in bytes",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 10),
+	}, []string{"handler_name", "encoding"})
+
+	decompressed := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_decompressed_size_bytes",
+		Help:    "size of the request bodies after decoding in bytes",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 10),
+	}, []string{"handler_name", "encoding"})
+
+	failures := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_request_decompression_failures_total",
+		Help: "number of request bodies which could not be decoded per reason",
+	}, []string{"handler_name", "reason"})
+
+	return defaultMetrics{compressed: compressed, decompressed: decompressed, failures: failures}
+}
+
+// Describe implements prometheus Collector interface.
+func (s defaultMetrics) Describe(in chan<- *prometheus.Desc) {
+	s.compressed.Describe(in)
+	s.decompressed.Describe(in)
+	s.failures.Describe(in)
+}
+
+// Collect implements prometheus Collector interface.
+func (s defaultMetrics) Collect(in chan<- prometheus.Metric) {
+	s.compressed.Collect(in)
+	s.decompressed.Collect(in)
+	s.failures.Collect(in)
+}
+
+// RegisterDefaultMetrics will register default decompression metrics instance in Prometheus. This is only needed if
+// any handlers are wrapped by Decompressed with default metrics (not overridden by WithMetrics() option)
+func RegisterDefaultMetrics(registerer prometheus.Registerer) error {
+	return registerer.Register(basicMetrics)
+}
+
+// UnregisterDefaultMetrics is a companion function to RegisterDefaultMetrics and must be called if RegisterDefaultMetrics
+// is used to cleanup the metrics in Prometheus
+func UnregisterDefaultMetrics(registerer prometheus.Registerer) {
+	registerer.Unregister(basicMetrics)
+}
+
+// Decompressed will transparently decode request bodies with supported content encodings (see: WithEncodings).
+// Requests with unsupported encodings or more than two stacked encodings are rejected with 415 and the list of
+// supported encodings in the Accept-Encoding header, requests with malformed encoding headers are rejected with 400.
+// Reading the body past the decompressed size limit (see: WithMaxDecompressedSize) fails with *http.MaxBytesError.
+// Sizes of the body before and after decoding are measured.
+func Decompressed(options ...Option) middlewares.Middleware {
+	o := newOptions(options...)
+	accepted := strings.Join(o.encodings, ", ")
+
+	fn := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Content-Encoding")
+			if len(header) == 0 || r.Body == nil || r.Body == http.NoBody {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			reject := func(reason string, status int, err error) {
+				o.metrics.GetFailures().WithLabelValues(o.name, reason).Inc()
+				if logger := logging.FromRequest(r); logger != nil {
+					logger.With("content_encoding", header, "reason", reason, "error", err).
+						Warn("could not decode request body")
+				}
+				if status != 0 {
+					http.Error(w, fmt.Sprintf("%d - %s", status, http.StatusText(status)), status)
+				}
+			}
+
+			encodings, unsupported := requestEncodings(header, o.encodings)
+			if len(unsupported) > 0 {
+				w.Header().Set("Accept-Encoding", accepted)
+				reject(ReasonUnsupported, http.StatusUnsupportedMediaType,
+					fmt.Errorf("compress: unsupported encoding: %s", unsupported))
+				return
+			}
+			if len(encodings) > maxRequestEncodings {
+				w.Header().Set("Accept-Encoding", accepted)
+				reject(ReasonUnsupported, http.StatusUnsupportedMediaType,
+					fmt.Errorf("compress: too many encodings: %d", len(encodings)))
+				return
+			}
+			if len(encodings) == 0 {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			compressed := &countingReader{r: r.Body}
+			var decoded io.Reader = compressed
+			for i := len(encodings) - 1; i >= 0; i-- {
+				d, release, err := newDecoder(encodings[i], decoded)
+				if err != nil {
+					reject(ReasonMalformed, http.StatusBadRequest, err)
+					return
+				}
+				defer release()
+				decoded = d
+			}
+			if o.maxDecompressed > 0 {
+				decoded = http.MaxBytesReader(w, io.NopCloser(decoded), o.maxDecompressed)
+			}
+
+			body := &decodedBody{Reader: decoded, body: r.Body, compressed: compressed}
+			r = r.WithContext(r.Context())
+			r.Body = body
+			r.ContentLength = -1
+			r.Header = r.Header.Clone()
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+
+			h.ServeHTTP(w, r)
+
+			encoding := strings.Join(encodings, ",")
+			o.metrics.GetCompressedSize().WithLabelValues(o.name, encoding).Observe(float64(compressed.read))
+			o.metrics.GetDecompressedSize().WithLabelValues(o.name, encoding).Observe(float64(body.decompressed))
+			if len(body.failure) > 0 {
+				reject(body.failure, 0, body.err)
+			}
+		})
+	}
+
+	return fn
+}
@@ -0,0 +1,186 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// encode returns the payload encoded with given content encoding
+func encode(t *testing.T, encoding string, payload []byte) []byte {
+	pool, err := newEncoderPool(encoding, defaultLevels[encoding])
+	if !assert.NoError(t, err, "could not create encoder") {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := pool.get(&buf)
+	_, err = enc.Write(payload)
+	assert.NoError(t, err, "could not encode payload")
+	assert.NoError(t, enc.Close(), "could not encode payload")
+	pool.put(enc)
+
+	return buf.Bytes()
+}
+
+// readBody returns the request body or the error as the response
+var readBody = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		w.Header().Set("X-Content-Encoding", r.Header.Get("Content-Encoding"))
+		w.Header().Set("X-Content-Length", r.Header.Get("Content-Length"))
+		_, _ = w.Write(body)
+	}
+})
+
+func TestRequestEncodings(t *testing.T) {
+	encodings, unsupported := requestEncodings("gzip, identity, BR", DefaultEncodings)
+	assert.Equal(t, []string{Gzip, Brotli}, encodings, "invalid encodings")
+	assert.Empty(t, unsupported, "all encodings are supported")
+
+	encodings, _ = requestEncodings("x-gzip", DefaultEncodings)
+	assert.Equal(t, []string{Gzip}, encodings, "legacy alias should be supported")
+
+	_, unsupported = requestEncodings("gzip, compress", DefaultEncodings)
+	assert.Equal(t, "compress", unsupported, "unsupported encoding not found")
+	_, unsupported = requestEncodings("zstd", []string{Gzip})
+	assert.Equal(t, Zstd, unsupported, "only configured encodings should be supported")
+}
+
+func TestDecompressed(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := newDefaultMetrics()
+	assert.NoError(t, registry.Register(metrics), "could not register decompression metrics")
+
+	payload := []byte(strings.Repeat(`{"event":"click"}`, 100))
+	handler := Decompressed(WithMetrics(metrics), WithName("batch"))(readBody)
+
+	for _, encoding := range DefaultEncodings {
+		t.Run(encoding, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", bytes.NewReader(encode(t, encoding, payload)))
+			r.Header.Set("Content-Encoding", encoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			assert.Equal(t, http.StatusOK, rec.Code, "invalid status")
+			assert.Equal(t, string(payload), rec.Body.String(), "body not decoded")
+			assert.Empty(t, rec.Header().Get("X-Content-Encoding"), "Content-Encoding should be removed")
+			assert.Empty(t, rec.Header().Get("X-Content-Length"), "Content-Length should be removed")
+		})
+	}
+
+	stacked := encode(t, Brotli, encode(t, Gzip, payload))
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(stacked))
+	r.Header.Set("Content-Encoding", "gzip, br")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, string(payload), rec.Body.String(), "stacked encodings not decoded")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/", bytes.NewReader(payload)))
+	assert.Equal(t, string(payload), rec.Body.String(), "plain body should be passed through")
+
+	body := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, body, `http_request_decompressed_size_bytes_sum{encoding="gzip",handler_name="batch"} 1700`,
+		"decompressed size not measured")
+	assert.Contains(t, body, `http_request_decompressed_size_bytes_count{encoding="gzip,br",handler_name="batch"} 1`,
+		"stacked encodings not measured")
+	assert.Contains(t, body, `http_request_compressed_size_bytes_count{encoding="zstd",handler_name="batch"} 1`,
+		"compressed size not measured")
+}
+
+func TestDecompressedFailures(t *testing.T) {
+	metrics := newDefaultMetrics()
+	logWatcher, logs := observer.New(zapcore.DebugLevel)
+	customLog := logging.LogGetter(func() (*zap.SugaredLogger, error) {
+		return zap.New(logWatcher).Sugar(), nil
+	})
+	handler := logging.InContext(logging.WithLogger(customLog))(
+		Decompressed(WithMetrics(metrics), WithEncodings(Gzip, Zstd), WithMaxDecompressedSize(100))(readBody))
+
+	payload := []byte(strings.Repeat("a", 1000))
+	tests := map[string]struct {
+		encoding string
+		body     []byte
+		status   int
+		reason   string
+	}{
+		"unsupported": {
+			encoding: Brotli,
+			body:     encode(t, Brotli, payload),
+			status:   http.StatusUnsupportedMediaType,
+			reason:   ReasonUnsupported,
+		},
+		"malformed header": {
+			encoding: Gzip,
+			body:     []byte("not gzip"),
+			status:   http.StatusBadRequest,
+			reason:   ReasonMalformed,
+		},
+		"malformed stream": {
+			encoding: Zstd,
+			body:     []byte("not zstd"),
+			status:   http.StatusBadRequest,
+			reason:   ReasonMalformed,
+		},
+		"too many encodings": {
+			encoding: "gzip, zstd, gzip",
+			body:     encode(t, Gzip, encode(t, Zstd, encode(t, Gzip, payload))),
+			status:   http.StatusUnsupportedMediaType,
+			reason:   ReasonUnsupported,
+		},
+		"stacked encodings bomb": {
+			encoding: strings.Repeat("gzip, ", 3000) + "gzip",
+			body:     encode(t, Gzip, payload),
+			status:   http.StatusUnsupportedMediaType,
+			reason:   ReasonUnsupported,
+		},
+		"decompression cap": {
+			encoding: Gzip,
+			body:     encode(t, Gzip, payload),
+			status:   http.StatusRequestEntityTooLarge,
+			reason:   ReasonTooLarge,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			counter := metrics.GetFailures().WithLabelValues("default", test.reason)
+			failures := testutil.ToFloat64(counter)
+			logged := logs.FilterField(zap.String("reason", test.reason)).Len()
+
+			r := httptest.NewRequest("POST", "/", bytes.NewReader(test.body))
+			r.Header.Set("Content-Encoding", test.encoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			assert.Equal(t, test.status, rec.Code, "invalid status")
+			assert.Equal(t, failures+1, testutil.ToFloat64(counter), "failure not counted")
+			assert.Equal(t, logged+1, logs.FilterField(zap.String("reason", test.reason)).Len(), "failure not logged")
+		})
+	}
+
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(encode(t, Brotli, payload)))
+	r.Header.Set("Content-Encoding", Brotli)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, "gzip, zstd", rec.Header().Get("Accept-Encoding"), "supported encodings not listed")
+}
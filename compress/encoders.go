@@ -0,0 +1,97 @@
+package compress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported content encodings
+const (
+	Gzip     = "gzip"
+	Deflate  = "deflate"
+	Brotli   = "br"
+	Zstd     = "zstd"
+	Identity = "identity"
+)
+
+// DefaultEncodings lists supported encodings in the order of preference used when the client accepts them equally
+var DefaultEncodings = []string{Zstd, Brotli, Gzip, Deflate}
+
+// defaultLevels holds the compression levels balancing the speed and the ratio for dynamic responses
+var defaultLevels = map[string]int{
+	Gzip:    gzip.DefaultCompression,
+	Deflate: zlib.DefaultCompression,
+	Brotli:  4,
+	Zstd:    3,
+}
+
+// encoder is implemented by the writers of all supported encodings
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// newEncoder creates the encoder of the content encoding with given compression level
+func newEncoder(encoding string, level int) (encoder, error) {
+	switch encoding {
+	case Gzip:
+		return gzip.NewWriterLevel(io.Discard, level)
+	case Deflate:
+		// "deflate" content encoding is the zlib format (RFC 9110)
+		return zlib.NewWriterLevel(io.Discard, level)
+	case Brotli:
+		if level < brotli.BestSpeed || level > brotli.BestCompression {
+			return nil, fmt.Errorf("compress: invalid brotli level: %d", level)
+		}
+		return brotli.NewWriterLevel(io.Discard, level), nil
+	case Zstd:
+		return zstd.NewWriter(io.Discard, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+			zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, fmt.Errorf("compress: unsupported encoding: %s", encoding)
+	}
+}
+
+// encoderPool reuses the encoders of a single content encoding
+type encoderPool struct {
+	pool sync.Pool
+}
+
+// newEncoderPool creates the pool of encoders, failing if the encoding or the level is invalid
+func newEncoderPool(encoding string, level int) (*encoderPool, error) {
+	enc, err := newEncoder(encoding, level)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &encoderPool{}
+	p.pool.New = func() any {
+		// options were validated when the pool was created
+		enc, _ := newEncoder(encoding, level)
+		return enc
+	}
+	p.pool.Put(enc)
+
+	return p, nil
+}
+
+// get returns the encoder writing to w
+func (p *encoderPool) get(w io.Writer) encoder {
+	enc := p.pool.Get().(encoder)
+	enc.Reset(w)
+	return enc
+}
+
+// put returns the closed encoder to the pool
+func (p *encoderPool) put(enc encoder) {
+	// do not hold the reference to the response writer
+	enc.Reset(io.Discard)
+	p.pool.Put(enc)
+}
@@ -0,0 +1,78 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// decode returns the body decoded with given content encoding
+func decode(t *testing.T, encoding string, body []byte) string {
+	var r io.Reader
+	var err error
+	switch encoding {
+	case Gzip:
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case Deflate:
+		r, err = zlib.NewReader(bytes.NewReader(body))
+	case Brotli:
+		r = brotli.NewReader(bytes.NewReader(body))
+	case Zstd:
+		var d *zstd.Decoder
+		d, err = zstd.NewReader(bytes.NewReader(body))
+		if err == nil {
+			defer d.Close()
+			r = d
+		}
+	default:
+		return string(body)
+	}
+	if !assert.NoError(t, err, "could not create decoder") {
+		return ""
+	}
+
+	decoded, err := io.ReadAll(r)
+	assert.NoError(t, err, "could not decode body")
+	return string(decoded)
+}
+
+func TestEncoderPool(t *testing.T) {
+	payload := strings.Repeat("compress me ", 100)
+	for _, encoding := range DefaultEncodings {
+		t.Run(encoding, func(t *testing.T) {
+			pool, err := newEncoderPool(encoding, defaultLevels[encoding])
+			if !assert.NoError(t, err, "could not create pool") {
+				return
+			}
+
+			// encoders should be reusable
+			for i := 0; i < 2; i++ {
+				var buf bytes.Buffer
+				enc := pool.get(&buf)
+				_, err = enc.Write([]byte(payload))
+				assert.NoError(t, err, "could not write")
+				assert.NoError(t, enc.Close(), "could not close")
+				pool.put(enc)
+
+				assert.Less(t, buf.Len(), len(payload), "body not compressed")
+				assert.Equal(t, payload, decode(t, encoding, buf.Bytes()), "invalid body")
+			}
+		})
+	}
+}
+
+func TestEncoderPoolInvalid(t *testing.T) {
+	_, err := newEncoderPool("compress", 1)
+	assert.Error(t, err, "unsupported encoding should fail")
+	_, err = newEncoderPool(Gzip, 42)
+	assert.Error(t, err, "invalid gzip level should fail")
+	_, err = newEncoderPool(Brotli, 12)
+	assert.Error(t, err, "invalid brotli level should fail")
+}
@@ -0,0 +1,80 @@
+package compress
+
+import (
+	"strconv"
+	"strings"
+)
+
+// acceptedEncoding is a single coding listed in the Accept-Encoding header
+type acceptedEncoding struct {
+	name string
+	q    float64
+}
+
+// parseAcceptEncoding parses the Accept-Encoding header into the list of codings with their q-values. Malformed
+// q-values make the coding unacceptable.
+func parseAcceptEncoding(header string) []acceptedEncoding {
+	var accepted []acceptedEncoding
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) == 0 {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, found := strings.Cut(param, "=")
+			if !found || !strings.EqualFold(strings.TrimSpace(key), "q") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			q = parsed
+		}
+		accepted = append(accepted, acceptedEncoding{name: name, q: q})
+	}
+
+	return accepted
+}
+
+// negotiate returns the supported encoding with the highest q-value in the Accept-Encoding header (ties are resolved
+// by the order of supported encodings) or an empty string if the response should not be encoded
+func negotiate(header string, supported []string) string {
+	accepted := parseAcceptEncoding(header)
+	if len(accepted) == 0 {
+		return ""
+	}
+
+	wildcard := -1.0
+	quality := map[string]float64{}
+	for _, a := range accepted {
+		if a.name == "*" {
+			wildcard = a.q
+			continue
+		}
+		quality[a.name] = a.q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range supported {
+		q, ok := quality[encoding]
+		if !ok && encoding == Gzip {
+			// legacy alias
+			q, ok = quality["x-gzip"]
+		}
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	if identity, ok := quality[Identity]; ok && identity > bestQ {
+		return ""
+	}
+
+	return best
+}
@@ -0,0 +1,38 @@
+package compress
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := map[string]struct {
+		header   string
+		expected string
+	}{
+		"no header":             {header: "", expected: ""},
+		"single":                {header: "gzip", expected: Gzip},
+		"server preference":     {header: "gzip, deflate, br, zstd", expected: Zstd},
+		"q-values":              {header: "gzip;q=1.0, br;q=0.8, zstd;q=0.5", expected: Gzip},
+		"case and spaces":       {header: " GZIP ; Q=0.5 , Deflate;q=0.9", expected: Deflate},
+		"excluded":              {header: "zstd;q=0, br;q=0, gzip", expected: Gzip},
+		"wildcard":              {header: "*", expected: Zstd},
+		"wildcard exclusion":    {header: "*;q=0, gzip;q=0.1", expected: Gzip},
+		"wildcard lower":        {header: "*;q=0.1, gzip;q=0.5", expected: Gzip},
+		"legacy alias":          {header: "x-gzip", expected: Gzip},
+		"identity preferred":    {header: "identity, gzip;q=0.5", expected: ""},
+		"unsupported":           {header: "compress, exi", expected: ""},
+		"malformed q":           {header: "br;q=high, gzip;q=0.2", expected: Gzip},
+		"out of range q":        {header: "br;q=2, gzip;q=0.2", expected: Gzip},
+		"other parameters only": {header: "gzip;level=1", expected: Gzip},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expected, negotiate(test.header, DefaultEncodings), "invalid encoding")
+		})
+	}
+
+	assert.Equal(t, Gzip, negotiate("gzip, br", []string{Gzip, Brotli}), "supported encodings order should be used")
+}
@@ -0,0 +1,233 @@
+package compress
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/harnash/go-middlewares"
+)
+
+// countingWriter counts the bytes of the encoded body written to the response
+type countingWriter struct {
+	w       http.ResponseWriter
+	written int64
+}
+
+// Write implements io.Writer interface
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.written += int64(n)
+	return n, err
+}
+
+// compressWriter buffers the beginning of the response until it can decide whether to encode it: the body reaches
+// the minimum size, the handler flushes the response or returns
+type compressWriter struct {
+	http.ResponseWriter
+	request  *http.Request
+	options  *options
+	encoding string
+	pool     *encoderPool
+
+	status       int
+	buf          []byte
+	decided      bool
+	enc          encoder
+	encoded      countingWriter
+	uncompressed int64
+	hijacked     bool
+}
+
+// WriteHeader implements net/http.ResponseWriter's WriteHeader()
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	// informational responses can be followed by other headers
+	if code < http.StatusOK && code != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	cw.status = code
+	if !cw.compressible() {
+		_ = cw.start(false)
+	}
+}
+
+// Write implements net/http.ResponseWriter's Write()
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.options.minSize {
+			return len(b), nil
+		}
+		// buffered bytes are reported as written
+		return len(b), cw.start(false)
+	}
+
+	if cw.enc != nil {
+		n, err := cw.enc.Write(b)
+		cw.uncompressed += int64(n)
+		return n, err
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush implements net/http.Flusher interface. Streamed responses are encoded regardless of the minimum size.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		if err := cw.start(true); err != nil {
+			return
+		}
+	}
+	if cw.enc != nil {
+		if err := cw.enc.Flush(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the original http.ResponseWriter (used by net/http.ResponseController)
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Hijack implements net/http.Hijacker interface. The connection is taken over by the handler so the response is not
+// finished once it returns.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(cw.ResponseWriter).Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// compressible reports if the response can be encoded judging by its status and headers
+func (cw *compressWriter) compressible() bool {
+	switch {
+	case cw.status < http.StatusOK, cw.status == http.StatusNoContent, cw.status == http.StatusNotModified,
+		cw.status == http.StatusPartialContent:
+		return false
+	case cw.request.Method == http.MethodHead:
+		return false
+	}
+
+	header := cw.Header()
+	if len(header.Get("Content-Encoding")) > 0 || len(header.Get("Content-Range")) > 0 {
+		// already encoded or partial response
+		return false
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < cw.options.minSize {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if len(contentType) == 0 {
+		// it will be sniffed from the body
+		return true
+	}
+
+	return allowedType(contentType, cw.options.contentTypes)
+}
+
+// start writes the headers and the buffered part of the body deciding whether the response is encoded. Small bodies
+// are encoded only if the response is streamed.
+func (cw *compressWriter) start(streamed bool) error {
+	cw.decided = true
+	header := cw.Header()
+	compressible := cw.compressible()
+	if contentType := header.Get("Content-Type"); compressible && len(contentType) == 0 {
+		if len(cw.buf) > 0 {
+			// encoded body can not be sniffed by net/http
+			contentType = http.DetectContentType(cw.buf)
+			header.Set("Content-Type", contentType)
+		}
+		compressible = allowedType(contentType, cw.options.contentTypes)
+	}
+
+	if compressible {
+		// the same resource is encoded for other clients
+		addVary(header, "Accept-Encoding")
+	}
+	if !compressible || cw.pool == nil || (!streamed && len(cw.buf) < cw.options.minSize) {
+		cw.ResponseWriter.WriteHeader(cw.status)
+		buf := cw.buf
+		cw.buf = nil
+		if len(buf) == 0 {
+			return nil
+		}
+		_, err := cw.ResponseWriter.Write(buf)
+		return err
+	}
+
+	header.Del("Content-Length")
+	header.Del("Accept-Ranges")
+	header.Set("Content-Encoding", cw.encoding)
+	if etag := header.Get("ETag"); len(etag) > 0 && !strings.HasPrefix(etag, "W/") {
+		// encoded representation is not byte-for-byte identical
+		header.Set("ETag", "W/"+etag)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	cw.encoded.w = cw.ResponseWriter
+	cw.enc = cw.pool.get(&cw.encoded)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	n, err := cw.enc.Write(buf)
+	cw.uncompressed += int64(n)
+	return err
+}
+
+// close finishes the response once the handler returns and reports the sizes of the encoded body
+func (cw *compressWriter) close() {
+	if cw.hijacked {
+		if cw.enc != nil {
+			cw.pool.put(cw.enc)
+			cw.enc = nil
+		}
+		return
+	}
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		_ = cw.start(false)
+	}
+	if cw.enc == nil {
+		return
+	}
+
+	_ = cw.enc.Close()
+	cw.pool.put(cw.enc)
+	cw.enc = nil
+	middlewares.RecordEncoding(cw.request.Context(), cw.encoding, cw.uncompressed, cw.encoded.written)
+}
+
+// addVary adds the header name to the Vary header unless it is already there
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
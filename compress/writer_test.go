@@ -0,0 +1,234 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// serve returns the response of the handler wrapped by Compressed for the request accepting given encodings
+func serve(h http.HandlerFunc, method, acceptEncoding string, options ...Option) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/", nil)
+	if len(acceptEncoding) > 0 {
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	Compressed(options...)(h).ServeHTTP(rec, r)
+
+	return rec
+}
+
+func TestCompressWriter(t *testing.T) {
+	large := strings.Repeat("<p>compress me</p>", 100)
+	tests := map[string]struct {
+		handler  http.HandlerFunc
+		method   string
+		encoding string
+		status   int
+		vary     bool
+	}{
+		"sniffed html": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(large))
+			},
+			encoding: Gzip,
+			status:   http.StatusOK,
+			vary:     true,
+		},
+		"small body": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				_, _ = w.Write([]byte("small"))
+			},
+			status: http.StatusOK,
+			vary:   true,
+		},
+		"small content length": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Length", "5")
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte("small"))
+			},
+			status: http.StatusOK,
+		},
+		"disallowed type": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = w.Write([]byte(large))
+			},
+			status: http.StatusOK,
+		},
+		"already encoded": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.Header().Set("Content-Encoding", Brotli)
+				_, _ = w.Write([]byte(large))
+			},
+			encoding: Brotli,
+			status:   http.StatusOK,
+		},
+		"no content": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			status: http.StatusNoContent,
+		},
+		"head": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				_, _ = w.Write([]byte(large))
+			},
+			method: http.MethodHead,
+			status: http.StatusOK,
+		},
+		"error status": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(large))
+			},
+			encoding: Gzip,
+			status:   http.StatusNotFound,
+			vary:     true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			method := test.method
+			if len(method) == 0 {
+				method = http.MethodGet
+			}
+			rec := serve(test.handler, method, "gzip")
+			assert.Equal(t, test.status, rec.Code, "invalid status")
+			assert.Equal(t, test.encoding, rec.Header().Get("Content-Encoding"), "invalid encoding")
+			if test.vary {
+				assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"), "invalid Vary header")
+			} else {
+				assert.Empty(t, rec.Header().Get("Vary"), "Vary header should not be set")
+			}
+			if test.encoding == Gzip {
+				assert.Empty(t, rec.Header().Get("Content-Length"), "Content-Length should be removed")
+				assert.Equal(t, large, decode(t, Gzip, rec.Body.Bytes()), "invalid body")
+			}
+		})
+	}
+}
+
+func TestCompressWriterHeaders(t *testing.T) {
+	rec := serve(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "2000")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Vary", "Origin, accept-encoding")
+		_, _ = w.Write([]byte(strings.Repeat("[]", 1000)))
+	}, http.MethodGet, "br")
+
+	assert.Equal(t, Brotli, rec.Header().Get("Content-Encoding"), "invalid encoding")
+	assert.Empty(t, rec.Header().Get("Content-Length"), "Content-Length should be removed")
+	assert.Empty(t, rec.Header().Get("Accept-Ranges"), "Accept-Ranges should be removed")
+	assert.Equal(t, `W/"v1"`, rec.Header().Get("ETag"), "strong ETag should be weakened")
+	assert.Equal(t, []string{"Origin, accept-encoding"}, rec.Header().Values("Vary"),
+		"Vary header should not be duplicated")
+	assert.Equal(t, strings.Repeat("[]", 1000), decode(t, Brotli, rec.Body.Bytes()), "invalid body")
+}
+
+func TestCompressWriterFlush(t *testing.T) {
+	chunks := make(chan string)
+	flushed := make(chan struct{})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "zstd")
+	rec := httptest.NewRecorder()
+	handler := Compressed()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for chunk := range chunks {
+			_, _ = w.Write([]byte(chunk))
+			w.(http.Flusher).Flush()
+			flushed <- struct{}{}
+		}
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(rec, r)
+	}()
+
+	chunks <- "data: first\n\n"
+	<-flushed
+	assert.True(t, rec.Flushed, "flush should be passed through")
+	assert.Equal(t, Zstd, rec.Header().Get("Content-Encoding"), "small streamed response should be encoded")
+	d, err := zstd.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	if assert.NoError(t, err, "could not create decoder") {
+		first := make([]byte, len("data: first\n\n"))
+		_, err = io.ReadFull(d, first)
+		assert.NoError(t, err, "flushed data should be decodable")
+		assert.Equal(t, "data: first\n\n", string(first), "invalid flushed data")
+		d.Close()
+	}
+
+	chunks <- "data: second\n\n"
+	<-flushed
+	close(chunks)
+	<-done
+	assert.Equal(t, "data: first\n\ndata: second\n\n", decode(t, Zstd, rec.Body.Bytes()), "invalid body")
+}
+
+func TestCompressWriterIdentity(t *testing.T) {
+	large := strings.Repeat("compress me ", 200)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(large))
+	}
+
+	rec := serve(handler, http.MethodGet, "")
+	assert.Empty(t, rec.Header().Get("Content-Encoding"), "response should not be encoded")
+	assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"), "Vary header should be set")
+	assert.Equal(t, large, rec.Body.String(), "invalid body")
+
+	rec = serve(handler, http.MethodGet, "gzip", WithMinSize(10000))
+	assert.Empty(t, rec.Header().Get("Content-Encoding"), "response below minimum size should not be encoded")
+	assert.Equal(t, large, rec.Body.String(), "invalid body")
+
+	rec = serve(handler, http.MethodGet, "gzip", WithContentTypes("application/json"))
+	assert.Empty(t, rec.Header().Get("Content-Encoding"), "response outside allowlist should not be encoded")
+}
+
+func TestCompressWriterHijack(t *testing.T) {
+	var serverLog bytes.Buffer
+	server := httptest.NewUnstartedServer(Compressed()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if !assert.NoError(t, err, "connection should be hijacked") {
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 3\r\nConnection: close\r\n\r\nraw")
+		_ = rw.Flush()
+	})))
+	server.Config.ErrorLog = log.New(&serverLog, "", 0)
+	server.Start()
+
+	r, err := http.NewRequest("GET", server.URL, nil)
+	assert.NoError(t, err, "could not create request")
+	r.Header.Set("Accept-Encoding", "gzip")
+	response, err := http.DefaultClient.Do(r)
+	if assert.NoError(t, err, "request failed") {
+		body, err := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		assert.NoError(t, err, "could not read body")
+		assert.Equal(t, "raw", string(body), "response written to the hijacked connection should be intact")
+		assert.Empty(t, response.Header.Get("Content-Encoding"), "hijacked response should not be encoded")
+	}
+	server.Close()
+	assert.Empty(t, serverLog.String(), "hijacked response should not be finished")
+}
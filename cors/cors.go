@@ -0,0 +1,318 @@
+package cors
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harnash/go-middlewares"
+	"github.com/harnash/go-middlewares/logging"
+)
+
+// CORS request and response headers
+const (
+	OriginHeader                = "Origin"
+	RequestMethodHeader         = "Access-Control-Request-Method"
+	RequestHeadersHeader        = "Access-Control-Request-Headers"
+	RequestPrivateNetworkHeader = "Access-Control-Request-Private-Network"
+	AllowOriginHeader           = "Access-Control-Allow-Origin"
+	AllowCredentialsHeader      = "Access-Control-Allow-Credentials"
+	AllowMethodsHeader          = "Access-Control-Allow-Methods"
+	AllowHeadersHeader          = "Access-Control-Allow-Headers"
+	AllowPrivateNetworkHeader   = "Access-Control-Allow-Private-Network"
+	ExposeHeadersHeader         = "Access-Control-Expose-Headers"
+	MaxAgeHeader                = "Access-Control-Max-Age"
+)
+
+// ErrCredentialsWithAnyOrigin is the panic value of Allowed if the credentials are allowed for all the origins, it
+// would let every website make credentialed requests and read the responses
+var ErrCredentialsWithAnyOrigin = errors.New("cors: credentials cannot be allowed for any origin")
+
+// DefaultMethods are the methods allowed by default (CORS-safelisted methods)
+var DefaultMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+type options struct {
+	origins         []string
+	patterns        []*regexp.Regexp
+	methods         []string
+	headers         []string
+	exposed         []string
+	credentials     bool
+	maxAge          time.Duration
+	privateNetwork  bool
+	preflightStatus int
+	debug           bool
+}
+
+// Option represents a CORS option.
+type Option func(*options)
+
+// WithOrigins sets the allowed origins. Origins must match exactly (eg. "https://example.com"), origins with the
+// wildcard allow all their subdomains (eg. "https://*.example.com") and "*" allows all the origins.
+func WithOrigins(origins ...string) Option {
+	return func(o *options) {
+		o.origins = origins
+	}
+}
+
+// WithOriginPatterns allows the origins matching any of the regular expressions. Origins are matched in lower case
+// and the expressions should be anchored (eg. `^https://[a-z]+\.example\.com$`).
+func WithOriginPatterns(patterns ...*regexp.Regexp) Option {
+	return func(o *options) {
+		o.patterns = patterns
+	}
+}
+
+// WithMethods sets the methods allowed in cross-origin requests (DefaultMethods by default)
+func WithMethods(methods ...string) Option {
+	return func(o *options) {
+		o.methods = methods
+	}
+}
+
+// WithAllowedHeaders sets the request headers allowed in cross-origin requests. "*" allows all the requested headers.
+func WithAllowedHeaders(headers ...string) Option {
+	return func(o *options) {
+		o.headers = headers
+	}
+}
+
+// WithExposedHeaders sets the response headers exposed to the cross-origin clients
+func WithExposedHeaders(headers ...string) Option {
+	return func(o *options) {
+		o.exposed = headers
+	}
+}
+
+// WithCredentials allows requests with credentials (cookies, TLS client certificates or authorization headers). The
+// origin of the request is sent back instead of "*". Credentials cannot be combined with allowing all the origins
+// ("*"), Allowed panics with ErrCredentialsWithAnyOrigin then.
+func WithCredentials(credentials bool) Option {
+	return func(o *options) {
+		o.credentials = credentials
+	}
+}
+
+// WithMaxAge sets how long the results of the preflight request can be cached by the client
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(o *options) {
+		o.maxAge = maxAge
+	}
+}
+
+// WithPrivateNetwork allows the requests from public websites to the private network (Private Network Access)
+func WithPrivateNetwork(privateNetwork bool) Option {
+	return func(o *options) {
+		o.privateNetwork = privateNetwork
+	}
+}
+
+// WithPreflightStatus sets the status of the preflight responses (204 No Content by default)
+func WithPreflightStatus(status int) Option {
+	return func(o *options) {
+		o.preflightStatus = status
+	}
+}
+
+// WithDebug enables logging of the reasons why cross-origin requests were rejected with the request logger
+func WithDebug(debug bool) Option {
+	return func(o *options) {
+		o.debug = debug
+	}
+}
+
+// newOptions takes functional options and returns options.
+func newOptions(opts ...Option) *options {
+	cfg := &options{
+		methods:         DefaultMethods,
+		preflightStatus: http.StatusNoContent,
+	}
+
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	return cfg
+}
+
+// policy holds the options prepared for handling requests
+type policy struct {
+	*options
+	allowed        *origins
+	methods        map[string]struct{}
+	allowedMethods string
+	headers        map[string]struct{}
+	anyHeader      bool
+	exposedHeaders string
+	maxAge         string
+}
+
+func newPolicy(o *options) *policy {
+	p := &policy{
+		options:        o,
+		allowed:        newOrigins(o.origins, o.patterns),
+		methods:        map[string]struct{}{},
+		allowedMethods: strings.Join(o.methods, ", "),
+		headers:        map[string]struct{}{},
+		exposedHeaders: strings.Join(o.exposed, ", "),
+	}
+	for _, method := range o.methods {
+		p.methods[strings.ToUpper(method)] = struct{}{}
+	}
+	for _, header := range o.headers {
+		if header == "*" {
+			p.anyHeader = true
+			continue
+		}
+		p.headers[strings.ToLower(header)] = struct{}{}
+	}
+	if o.maxAge > 0 {
+		p.maxAge = strconv.FormatInt(int64(o.maxAge/time.Second), 10)
+	}
+
+	return p
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header
+func (p *policy) allowOrigin(origin string) string {
+	if p.allowed.all {
+		return "*"
+	}
+	return origin
+}
+
+// varyOrigin reports if the response depends on the Origin header
+func (p *policy) varyOrigin() bool {
+	return !p.allowed.all
+}
+
+// reject logs the reason of rejecting the cross-origin request in debug mode
+func (p *policy) reject(r *http.Request, reason string) {
+	if !p.debug {
+		return
+	}
+	if logger := logging.FromRequest(r); logger != nil {
+		logger.With("origin", r.Header.Get(OriginHeader), "method", r.Method, "reason", reason).
+			Info("cross-origin request rejected")
+	}
+}
+
+// preflight handles the preflight request
+func (p *policy) preflight(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	header.Add("Vary", OriginHeader)
+	header.Add("Vary", RequestMethodHeader)
+	header.Add("Vary", RequestHeadersHeader)
+	if p.privateNetwork {
+		header.Add("Vary", RequestPrivateNetworkHeader)
+	}
+	defer w.WriteHeader(p.preflightStatus)
+
+	origin := r.Header.Get(OriginHeader)
+	if !p.allowed.match(origin) {
+		p.reject(r, "origin not allowed")
+		return
+	}
+
+	method := r.Header.Get(RequestMethodHeader)
+	if _, ok := p.methods[method]; !ok {
+		p.reject(r, "method not allowed: "+method)
+		return
+	}
+
+	var requested []string
+	for _, value := range r.Header.Values(RequestHeadersHeader) {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if len(name) == 0 {
+				continue
+			}
+			if _, ok := p.headers[name]; !ok && !p.anyHeader {
+				p.reject(r, "header not allowed: "+name)
+				return
+			}
+			requested = append(requested, name)
+		}
+	}
+
+	privateNetwork := r.Header.Get(RequestPrivateNetworkHeader) == "true"
+	if privateNetwork && !p.privateNetwork {
+		p.reject(r, "private network access not allowed")
+		return
+	}
+
+	header.Set(AllowOriginHeader, p.allowOrigin(origin))
+	if p.credentials {
+		header.Set(AllowCredentialsHeader, "true")
+	}
+	header.Set(AllowMethodsHeader, p.allowedMethods)
+	if len(requested) > 0 {
+		// "*" is not honoured in requests with credentials so the requested headers are sent back
+		header.Set(AllowHeadersHeader, strings.Join(requested, ", "))
+	}
+	if privateNetwork {
+		header.Set(AllowPrivateNetworkHeader, "true")
+	}
+	if len(p.maxAge) > 0 {
+		header.Set(MaxAgeHeader, p.maxAge)
+	}
+}
+
+// actual adds the CORS headers to the response of the actual request
+func (p *policy) actual(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	if p.varyOrigin() {
+		header.Add("Vary", OriginHeader)
+	}
+
+	origin := r.Header.Get(OriginHeader)
+	if len(origin) == 0 {
+		return
+	}
+	if !p.allowed.match(origin) {
+		p.reject(r, "origin not allowed")
+		return
+	}
+	if _, ok := p.methods[r.Method]; !ok {
+		p.reject(r, "method not allowed: "+r.Method)
+		return
+	}
+
+	header.Set(AllowOriginHeader, p.allowOrigin(origin))
+	if p.credentials {
+		header.Set(AllowCredentialsHeader, "true")
+	}
+	if len(p.exposedHeaders) > 0 {
+		header.Set(ExposeHeadersHeader, p.exposedHeaders)
+	}
+}
+
+// Allowed will handle Cross-Origin Resource Sharing: preflight requests are answered without calling the handler,
+// responses to the actual requests from the allowed origins get the CORS headers. Responses depending on the origin
+// of the request are marked with "Vary: Origin". Requests from other origins are not blocked, the client just does not
+// get the CORS headers (the reason is logged in debug mode, see: WithDebug). Allowed panics with
+// ErrCredentialsWithAnyOrigin if the credentials are allowed for all the origins.
+func Allowed(options ...Option) middlewares.Middleware {
+	p := newPolicy(newOptions(options...))
+	if p.allowed.all && p.credentials {
+		panic(ErrCredentialsWithAnyOrigin)
+	}
+
+	fn := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions && len(r.Header.Get(OriginHeader)) > 0 &&
+				len(r.Header.Get(RequestMethodHeader)) > 0 {
+				p.preflight(w, r)
+				return
+			}
+
+			p.actual(w, r)
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	return fn
+}
@@ -0,0 +1,150 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Handled", "yes")
+	w.WriteHeader(http.StatusOK)
+})
+
+// preflight returns the preflight request from the origin
+func preflight(origin, method string, headers string) *http.Request {
+	r := httptest.NewRequest(http.MethodOptions, "/items", nil)
+	r.Header.Set(OriginHeader, origin)
+	r.Header.Set(RequestMethodHeader, method)
+	if len(headers) > 0 {
+		r.Header.Set(RequestHeadersHeader, headers)
+	}
+	return r
+}
+
+func TestAllowedPreflight(t *testing.T) {
+	handler := Allowed(WithOrigins("https://example.com"), WithMethods(http.MethodGet, http.MethodPut),
+		WithAllowedHeaders("Content-Type", "X-Request-Id"), WithMaxAge(10*time.Minute))(okHandler)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, preflight("https://example.com", http.MethodPut, "content-type, X-Request-ID"))
+	assert.Equal(t, http.StatusNoContent, rec.Code, "invalid preflight status")
+	assert.Empty(t, rec.Header().Get("X-Handled"), "preflight should not reach the handler")
+	assert.Equal(t, "https://example.com", rec.Header().Get(AllowOriginHeader), "invalid allowed origin")
+	assert.Equal(t, "GET, PUT", rec.Header().Get(AllowMethodsHeader), "invalid allowed methods")
+	assert.Equal(t, "content-type, x-request-id", rec.Header().Get(AllowHeadersHeader), "invalid allowed headers")
+	assert.Equal(t, "600", rec.Header().Get(MaxAgeHeader), "invalid max age")
+	assert.Empty(t, rec.Header().Get(AllowCredentialsHeader), "credentials should not be allowed")
+	assert.Equal(t, []string{OriginHeader, RequestMethodHeader, RequestHeadersHeader}, rec.Header().Values("Vary"),
+		"invalid Vary header")
+
+	rejected := map[string]*http.Request{
+		"origin": preflight("https://evil.com", http.MethodPut, ""),
+		"method": preflight("https://example.com", http.MethodDelete, ""),
+		"header": preflight("https://example.com", http.MethodPut, "Authorization"),
+	}
+	for name, r := range rejected {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			assert.Equal(t, http.StatusNoContent, rec.Code, "invalid preflight status")
+			assert.Empty(t, rec.Header().Get(AllowOriginHeader), "rejected preflight should not allow the origin")
+			assert.Empty(t, rec.Header().Get("X-Handled"), "preflight should not reach the handler")
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodOptions, "/items", nil)
+	r.Header.Set(OriginHeader, "https://example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, "yes", rec.Header().Get("X-Handled"), "OPTIONS request without requested method is not a preflight")
+}
+
+func TestAllowedActual(t *testing.T) {
+	handler := Allowed(WithOrigins("https://*.example.com"), WithCredentials(true),
+		WithExposedHeaders("X-Total-Count", "X-Request-Id"))(okHandler)
+
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.Header.Set(OriginHeader, "https://app.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, "yes", rec.Header().Get("X-Handled"), "request should reach the handler")
+	assert.Equal(t, "https://app.example.com", rec.Header().Get(AllowOriginHeader), "invalid allowed origin")
+	assert.Equal(t, "true", rec.Header().Get(AllowCredentialsHeader), "credentials should be allowed")
+	assert.Equal(t, "X-Total-Count, X-Request-Id", rec.Header().Get(ExposeHeadersHeader), "invalid exposed headers")
+	assert.Equal(t, OriginHeader, rec.Header().Get("Vary"), "invalid Vary header")
+
+	r.Header.Set(OriginHeader, "https://evil.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, "yes", rec.Header().Get("X-Handled"), "request should reach the handler")
+	assert.Empty(t, rec.Header().Get(AllowOriginHeader), "origin should not be allowed")
+	assert.Equal(t, OriginHeader, rec.Header().Get("Vary"), "response depending on the origin should vary")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items", nil))
+	assert.Empty(t, rec.Header().Get(AllowOriginHeader), "same-origin request should not get CORS headers")
+	assert.Equal(t, OriginHeader, rec.Header().Get("Vary"), "response depending on the origin should vary")
+}
+
+func TestAllowedAnyOrigin(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.Header.Set(OriginHeader, "https://example.com")
+
+	rec := httptest.NewRecorder()
+	Allowed(WithOrigins("*"))(okHandler).ServeHTTP(rec, r)
+	assert.Equal(t, "*", rec.Header().Get(AllowOriginHeader), "all origins should be allowed")
+	assert.Empty(t, rec.Header().Get("Vary"), "response should not depend on the origin")
+
+	assert.PanicsWithValue(t, ErrCredentialsWithAnyOrigin, func() {
+		Allowed(WithOrigins("*"), WithCredentials(true))
+	}, "credentials should not be allowed for any origin")
+
+	rec = httptest.NewRecorder()
+	Allowed(WithOrigins("*"), WithAllowedHeaders("*"))(okHandler).ServeHTTP(rec,
+		preflight("https://example.com", http.MethodGet, "X-Custom"))
+	assert.Equal(t, "x-custom", rec.Header().Get(AllowHeadersHeader), "all requested headers should be allowed")
+}
+
+func TestAllowedPrivateNetwork(t *testing.T) {
+	r := preflight("https://example.com", http.MethodGet, "")
+	r.Header.Set(RequestPrivateNetworkHeader, "true")
+
+	rec := httptest.NewRecorder()
+	Allowed(WithOrigins("https://example.com"))(okHandler).ServeHTTP(rec, r)
+	assert.Empty(t, rec.Header().Get(AllowOriginHeader), "private network access should not be allowed")
+
+	rec = httptest.NewRecorder()
+	Allowed(WithOrigins("https://example.com"), WithPrivateNetwork(true), WithPreflightStatus(http.StatusOK))(
+		okHandler).ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusOK, rec.Code, "invalid preflight status")
+	assert.Equal(t, "true", rec.Header().Get(AllowPrivateNetworkHeader), "private network access should be allowed")
+	assert.Contains(t, rec.Header().Values("Vary"), RequestPrivateNetworkHeader, "invalid Vary header")
+}
+
+func TestAllowedDebug(t *testing.T) {
+	logWatcher, logs := observer.New(zapcore.DebugLevel)
+	customLog := logging.LogGetter(func() (*zap.SugaredLogger, error) {
+		return zap.New(logWatcher).Sugar(), nil
+	})
+
+	r := preflight("https://example.com", http.MethodDelete, "")
+	logging.InContext(logging.WithLogger(customLog))(Allowed(WithOrigins("https://example.com"))(okHandler)).
+		ServeHTTP(httptest.NewRecorder(), r)
+	assert.Zero(t, logs.Len(), "rejections should be logged only in debug mode")
+
+	logging.InContext(logging.WithLogger(customLog))(Allowed(WithOrigins("https://example.com"), WithDebug(true))(
+		okHandler)).ServeHTTP(httptest.NewRecorder(), r)
+	if assert.Equal(t, 1, logs.FilterMessage("cross-origin request rejected").Len(), "rejection not logged") {
+		fields := logs.FilterMessage("cross-origin request rejected").All()[0].ContextMap()
+		assert.Equal(t, "method not allowed: DELETE", fields["reason"], "invalid reason")
+		assert.Equal(t, "https://example.com", fields["origin"], "invalid origin")
+	}
+}
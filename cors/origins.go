@@ -0,0 +1,75 @@
+package cors
+
+import (
+	"regexp"
+	"strings"
+)
+
+// wildcardOrigin matches the subdomains of the origin, eg. "https://*.example.com"
+type wildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+// match reports if the origin is a subdomain (of any depth) of the wildcard origin
+func (w wildcardOrigin) match(origin string) bool {
+	if len(origin) <= len(w.prefix)+len(w.suffix) ||
+		!strings.HasPrefix(origin, w.prefix) || !strings.HasSuffix(origin, w.suffix) {
+		return false
+	}
+
+	subdomain := origin[len(w.prefix) : len(origin)-len(w.suffix)]
+	return !strings.ContainsAny(subdomain, "/:@?#")
+}
+
+// origins holds all the allowed origins
+type origins struct {
+	all       bool
+	exact     map[string]struct{}
+	wildcards []wildcardOrigin
+	patterns  []*regexp.Regexp
+}
+
+// newOrigins parses the allowed origins: "*" allows all the origins, origins with "*." allow their subdomains, others
+// must match exactly
+func newOrigins(allowed []string, patterns []*regexp.Regexp) *origins {
+	o := &origins{exact: map[string]struct{}{}, patterns: patterns}
+	for _, origin := range allowed {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		if origin == "*" {
+			o.all = true
+			continue
+		}
+		if prefix, suffix, ok := strings.Cut(origin, "*."); ok {
+			o.wildcards = append(o.wildcards, wildcardOrigin{prefix: prefix, suffix: "." + suffix})
+			continue
+		}
+		o.exact[origin] = struct{}{}
+	}
+
+	return o
+}
+
+// match reports if the origin is allowed
+func (o *origins) match(origin string) bool {
+	if o.all {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if _, ok := o.exact[origin]; ok {
+		return true
+	}
+	for _, w := range o.wildcards {
+		if w.match(origin) {
+			return true
+		}
+	}
+	for _, pattern := range o.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,41 @@
+package cors
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrigins(t *testing.T) {
+	o := newOrigins([]string{"https://example.com", "https://*.example.org", "http://*.local:8080"},
+		[]*regexp.Regexp{regexp.MustCompile(`^https://pr-[0-9]+\.preview\.dev$`)})
+
+	tests := map[string]bool{
+		"https://example.com":           true,
+		"HTTPS://Example.com":           true,
+		"http://example.com":            false,
+		"https://example.com:8443":      false,
+		"https://api.example.com":       false,
+		"https://api.example.org":       true,
+		"https://a.b.example.org":       true,
+		"https://example.org":           false,
+		"https://.example.org":          false,
+		"https://evil.com/.example.org": false,
+		"https://user@x.example.org":    false,
+		"https://evilexample.org":       false,
+		"http://app.local:8080":         true,
+		"http://app.local":              false,
+		"https://pr-42.preview.dev":     true,
+		"https://pr-x.preview.dev":      false,
+		"null":                          false,
+	}
+
+	for origin, expected := range tests {
+		assert.Equal(t, expected, o.match(origin), "invalid match of %s", origin)
+	}
+
+	all := newOrigins([]string{"*"}, nil)
+	assert.True(t, all.match("https://anything.example"), "all origins should be allowed")
+	assert.True(t, newOrigins([]string{"null"}, nil).match("null"), "null origin should be allowed explicitly")
+}
@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"context"
+	"sync"
+)
+
+type key int
+
+const encodingStatsKey key = 461
+
+// EncodingStats holds the sizes of the response body before and after the content encoding (eg. compression) applied
+// by a middleware placed later in the chain
+type EncodingStats struct {
+	lock         sync.Mutex
+	encoding     string
+	uncompressed int64
+	compressed   int64
+}
+
+// WithEncodingStats returns a copy of the context in which the content encoding of the response can be recorded (see:
+// RecordEncoding). If the context already holds the stats it is returned unchanged so all the middlewares observing
+// the response share them.
+func WithEncodingStats(ctx context.Context) (context.Context, *EncodingStats) {
+	if stats, ok := ctx.Value(encodingStatsKey).(*EncodingStats); ok {
+		return ctx, stats
+	}
+
+	stats := &EncodingStats{}
+	return context.WithValue(ctx, encodingStatsKey, stats), stats
+}
+
+// RecordEncoding will record the content encoding of the response with the size of the body before (uncompressed)
+// and after (compressed) the encoding. It is meant to be called by encoding middlewares once the response is written.
+func RecordEncoding(ctx context.Context, encoding string, uncompressed, compressed int64) {
+	if stats, ok := ctx.Value(encodingStatsKey).(*EncodingStats); ok {
+		stats.lock.Lock()
+		defer stats.lock.Unlock()
+		stats.encoding = encoding
+		stats.uncompressed = uncompressed
+		stats.compressed = compressed
+	}
+}
+
+// Get returns the recorded content encoding with the sizes of the response body and true if anything was recorded
+func (s *EncodingStats) Get() (encoding string, uncompressed, compressed int64, ok bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.encoding, s.uncompressed, s.compressed, len(s.encoding) > 0
+}
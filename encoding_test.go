@@ -0,0 +1,27 @@
+package middlewares
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodingStats(t *testing.T) {
+	RecordEncoding(context.Background(), "gzip", 100, 10)
+
+	ctx, stats := WithEncodingStats(context.Background())
+	_, _, _, ok := stats.Get()
+	assert.False(t, ok, "nothing should be recorded yet")
+
+	shared, sharedStats := WithEncodingStats(ctx)
+	assert.Equal(t, ctx, shared, "context with stats should not be copied")
+	assert.Same(t, stats, sharedStats, "stats should be shared")
+
+	RecordEncoding(shared, "gzip", 100, 10)
+	encoding, uncompressed, compressed, ok := stats.Get()
+	assert.True(t, ok, "encoding not recorded")
+	assert.Equal(t, "gzip", encoding, "invalid encoding")
+	assert.Equal(t, int64(100), uncompressed, "invalid uncompressed size")
+	assert.Equal(t, int64(10), compressed, "invalid compressed size")
+}
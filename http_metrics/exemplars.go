@@ -0,0 +1,49 @@
+package http_metrics
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/uber/jaeger-client-go"
+)
+
+// ExemplarGetter returns exemplar labels for observations made while handling the request with a given context.
+// Returning nil means that no exemplar should be attached.
+type ExemplarGetter func(ctx context.Context) prometheus.Labels
+
+// TraceExemplar returns exemplar with the "trace_id" label of the sampled span found in the request context (see:
+// tracing.Traced). Exemplars are exposed only when metrics are scraped using OpenMetrics format.
+func TraceExemplar(ctx context.Context) prometheus.Labels {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+
+	sc, ok := span.Context().(jaeger.SpanContext)
+	if !ok || !sc.IsSampled() {
+		return nil
+	}
+
+	return prometheus.Labels{"trace_id": sc.TraceID().String()}
+}
+
+// addWithExemplar increments the counter attaching exemplar if it is available
+func addWithExemplar(counter prometheus.Counter, value float64, exemplar prometheus.Labels) {
+	if adder, ok := counter.(prometheus.ExemplarAdder); ok && exemplar != nil {
+		adder.AddWithExemplar(value, exemplar)
+		return
+	}
+
+	counter.Add(value)
+}
+
+// observeWithExemplar observes the value attaching exemplar if it is available
+func observeWithExemplar(observer prometheus.Observer, value float64, exemplar prometheus.Labels) {
+	if eo, ok := observer.(prometheus.ExemplarObserver); ok && exemplar != nil {
+		eo.ObserveWithExemplar(value, exemplar)
+		return
+	}
+
+	observer.Observe(value)
+}
@@ -0,0 +1,88 @@
+package http_metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
+)
+
+func findMetric(families []*dto.MetricFamily, name string) *dto.Metric {
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0]
+		}
+	}
+	return nil
+}
+
+func TestTraceExemplarsAndNativeHistograms(t *testing.T) {
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry, WithNativeHistograms(1.1, 100))
+	assert.NoError(t, err, "could not create metrics")
+
+	handler := Measured(WithName("traced"), WithMetrics(metrics))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	span := tracer.StartSpan("request")
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(opentracing.ContextWithSpan(req.Context(), span))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	span.Finish()
+
+	traceID := span.Context().(jaeger.SpanContext).TraceID().String()
+	families, err := registry.Gather()
+	if assert.NoError(t, err, "could not gather metrics") {
+		counter := findMetric(families, "http_requests_total")
+		if assert.NotNil(t, counter, "http_requests_total not found") && assert.NotNil(t, counter.GetCounter().GetExemplar(), "counter exemplar missing") {
+			assert.Equal(t, "trace_id", counter.GetCounter().GetExemplar().GetLabel()[0].GetName(), "invalid exemplar label")
+			assert.Equal(t, traceID, counter.GetCounter().GetExemplar().GetLabel()[0].GetValue(), "invalid exemplar trace ID")
+		}
+
+		statuses := findMetric(families, "http_handler_statuses_total")
+		if assert.NotNil(t, statuses, "http_handler_statuses_total not found") {
+			assert.NotNil(t, statuses.GetCounter().GetExemplar(), "status counter exemplar missing")
+		}
+
+		duration := findMetric(families, "http_request_duration_seconds")
+		if assert.NotNil(t, duration, "http_request_duration_seconds not found") {
+			assert.NotEmpty(t, duration.GetHistogram().GetPositiveSpan(), "native histogram buckets missing")
+			assert.NotEmpty(t, duration.GetHistogram().GetBucket(), "classic histogram buckets missing")
+			assert.NotEmpty(t, duration.GetHistogram().GetExemplars(), "histogram exemplar missing")
+		}
+	}
+}
+
+func TestExemplarsDisabled(t *testing.T) {
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	assert.NoError(t, err, "could not create metrics")
+
+	handler := Measured(WithName("traced"), WithMetrics(metrics), WithExemplars(nil))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	span := tracer.StartSpan("request")
+	req := httptest.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(opentracing.ContextWithSpan(req.Context(), span)))
+
+	families, err := registry.Gather()
+	if assert.NoError(t, err, "could not gather metrics") {
+		counter := findMetric(families, "http_requests_total")
+		if assert.NotNil(t, counter, "http_requests_total not found") {
+			assert.Nil(t, counter.GetCounter().GetExemplar(), "exemplar should not be attached")
+		}
+	}
+}
@@ -1,47 +1,57 @@
 package http_metrics
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/harnash/go-middlewares"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/metric"
 )
 
 type options struct {
 	metrics     Metrics
 	handlerName string
+	namer       HandlerNamer
+	maxNames    int
+	statusLabel StatusLabeler
+	exemplar    ExemplarGetter
+	route       RouteExtractor
+	apdex       *apdexThresholds
+	slos        []slo
+
+	meterProvider metric.MeterProvider
 }
 
 // Option represents a logger option.
 type Option func(*options)
 
-type statusRecorder struct {
-	http.ResponseWriter
-	status int
-}
-
-//WithMetrics sets custom metric collector/container for http metrics
+// WithMetrics sets custom metric collector/container for http metrics
 func WithMetrics(metrics Metrics) Option {
 	return func(o *options) {
 		o.metrics = metrics
 	}
 }
 
-//WithName sets the name of the http handler that is going to be used in metrics
-func WithName(handlerName string) Option {
+// WithExemplars sets the function used to get exemplar labels from the request context (TraceExemplar by default).
+// Use nil to disable exemplars.
+func WithExemplars(getter ExemplarGetter) Option {
 	return func(o *options) {
-		o.handlerName = handlerName
+		o.exemplar = getter
 	}
 }
 
-//WriteHeader will capture http status code returned/set by the http.Handler
-func (rec *statusRecorder) WriteHeader(code int) {
-	rec.status = code
-	rec.ResponseWriter.WriteHeader(code)
+// WithName sets the name of the http handler that is going to be used in metrics. By default the name of the wrapped
+// handler function (or the type of the wrapped handler) is used.
+func WithName(handlerName string) Option {
+	return func(o *options) {
+		o.handlerName = handlerName
+	}
 }
 
-//Metrics defines interface for custom metric collector/container
+// Metrics defines interface for custom metric collector/container
 type Metrics interface {
 	prometheus.Collector
 	GetTotalRequests() *prometheus.CounterVec
@@ -53,112 +63,330 @@ type Metrics interface {
 	GetHandlerStatuses() *prometheus.CounterVec
 }
 
-//defaultMetrics holds all the metrics regarding HTTP requests
+// ConcurrencyMetrics is an optional interface of the custom metric collector/container. The number of requests in
+// flight, its peak and the queue wait time (see: middlewares.RecordQueueWait) are tracked only if Metrics implement it.
+type ConcurrencyMetrics interface {
+	GetInFlight() *prometheus.GaugeVec
+	GetMaxInFlight() *PeakGaugeVec
+	GetQueueWait() *prometheus.HistogramVec
+}
+
+// RouteMetrics is an optional interface of the custom metric collector/container. Request metrics are labelled with
+// the "route" label only if Metrics implement it and return non-nil RouteLimiter.
+type RouteMetrics interface {
+	GetRoutes() *RouteLimiter
+}
+
+// ObjectiveMetrics is an optional interface of the custom metric collector/container. Metrics must implement it to be
+// used with WithApdex, WithAvailabilitySLO and WithLatencySLO options.
+type ObjectiveMetrics interface {
+	GetApdex() *prometheus.CounterVec
+	GetSLOEvents() *prometheus.CounterVec
+	GetSLOGoodEvents() *prometheus.CounterVec
+	GetSLOObjective() *prometheus.GaugeVec
+}
+
+// CompressionMetrics is an optional interface of the custom metric collector/container. Size of the responses before
+// the content encoding is observed only if Metrics implement it.
+type CompressionMetrics interface {
+	GetUncompressedResponseSize() *prometheus.HistogramVec
+}
+
+// defaultMetrics holds all the metrics regarding HTTP requests
 type defaultMetrics struct {
 	totalRequests   *prometheus.CounterVec
 	duration        *prometheus.HistogramVec
 	responseSize    *prometheus.HistogramVec
+	uncompressed    *prometheus.HistogramVec
 	requestSize     *prometheus.HistogramVec
 	timeToWrite     *prometheus.HistogramVec
 	handlerDuration *prometheus.HistogramVec
 	handlerStatuses *prometheus.CounterVec
+	inFlight        *prometheus.GaugeVec
+	maxInFlight     *PeakGaugeVec
+	queueWait       *prometheus.HistogramVec
+	routes          *RouteLimiter
+	apdex           *prometheus.CounterVec
+	sloEvents       *prometheus.CounterVec
+	sloGoodEvents   *prometheus.CounterVec
+	sloObjective    *prometheus.GaugeVec
 }
 
-var basicMetrics = newDefaultMetrics()
+var basicMetrics = newDefaultMetrics(&metricsOptions{})
 
-//GetTotalRequests return metric that will measure total number of requests
+// GetTotalRequests return metric that will measure total number of requests
 func (s defaultMetrics) GetTotalRequests() *prometheus.CounterVec {
 	return s.totalRequests
 }
 
-//GetDuration return metric that will measure the total request duration
+// GetDuration return metric that will measure the total request duration
 func (s defaultMetrics) GetDuration() *prometheus.HistogramVec {
 	return s.duration
 }
 
-//GetResponseSize return metric that is tracking size of the responses
+// GetResponseSize return metric that is tracking size of the responses
 func (s defaultMetrics) GetResponseSize() *prometheus.HistogramVec {
 	return s.responseSize
 }
 
-//GetRequestSize return metric that tracks the size of the requests
+// GetUncompressedResponseSize return metric that will measure size of the responses before the content encoding
+func (s defaultMetrics) GetUncompressedResponseSize() *prometheus.HistogramVec {
+	return s.uncompressed
+}
+
+// GetRequestSize return metric that tracks the size of the requests
 func (s defaultMetrics) GetRequestSize() *prometheus.HistogramVec {
 	return s.requestSize
 }
 
-//GetTimeToWrite return metric that tracks time to first write
+// GetTimeToWrite return metric that tracks time to first write
 func (s defaultMetrics) GetTimeToWrite() *prometheus.HistogramVec {
 	return s.timeToWrite
 }
 
-//GetHandlerDuration will return metric which tracks how long it takes to handle requests (pre handler)
+// GetHandlerDuration will return metric which tracks how long it takes to handle requests (pre handler)
 func (s defaultMetrics) GetHandlerDuration() *prometheus.HistogramVec {
 	return s.handlerDuration
 }
 
-//GetHandlerStatuses will return metric that will track response statuses for a given handler
+// GetHandlerStatuses will return metric that will track response statuses for a given handler
 func (s defaultMetrics) GetHandlerStatuses() *prometheus.CounterVec {
 	return s.handlerStatuses
 }
 
-// newOptions takes functional options and returns options.
-func newOptions(opts ...Option) *options {
+// GetInFlight will return metric that tracks number of requests being handled by a given handler
+func (s defaultMetrics) GetInFlight() *prometheus.GaugeVec {
+	return s.inFlight
+}
+
+// GetMaxInFlight will return metric that tracks the peak number of concurrent requests since the last scrape
+func (s defaultMetrics) GetMaxInFlight() *PeakGaugeVec {
+	return s.maxInFlight
+}
+
+// GetQueueWait will return metric that tracks how long requests waited in the concurrency limiter queue
+func (s defaultMetrics) GetQueueWait() *prometheus.HistogramVec {
+	return s.queueWait
+}
+
+// GetRoutes will return the limiter of "route" label values or nil if metrics do not have the "route" label
+func (s defaultMetrics) GetRoutes() *RouteLimiter {
+	return s.routes
+}
+
+// GetApdex will return metric that counts requests per Apdex zone for a given handler
+func (s defaultMetrics) GetApdex() *prometheus.CounterVec {
+	return s.apdex
+}
+
+// GetSLOEvents will return metric that counts all events of the handler SLOs
+func (s defaultMetrics) GetSLOEvents() *prometheus.CounterVec {
+	return s.sloEvents
+}
+
+// GetSLOGoodEvents will return metric that counts good events of the handler SLOs
+func (s defaultMetrics) GetSLOGoodEvents() *prometheus.CounterVec {
+	return s.sloGoodEvents
+}
+
+// GetSLOObjective will return metric that exposes objectives of the handler SLOs
+func (s defaultMetrics) GetSLOObjective() *prometheus.GaugeVec {
+	return s.sloObjective
+}
+
+// newOptions takes functional options and returns validated options.
+func newOptions(opts ...Option) (*options, error) {
 	cfg := &options{
-		metrics: basicMetrics,
+		metrics:     basicMetrics,
 		handlerName: "",
+		exemplar:    TraceExemplar,
+		maxNames:    DefaultMaxNames,
 	}
 
 	for _, o := range opts {
 		o(cfg)
 	}
 
-	if cfg.handlerName == "" {
-		panic("handler name is not specified - cannot gather http metrics")
+	if cfg.metrics == nil && cfg.meterProvider == nil {
+		return nil, errors.New("http_metrics: metrics are not specified")
+	}
+	if cfg.meterProvider != nil && (cfg.apdex != nil || len(cfg.slos) > 0 || cfg.statusLabel != nil || cfg.namer != nil) {
+		return nil, errors.New("http_metrics: Apdex, SLOs, status labels and namer are not supported with meter provider")
+	}
+	if _, ok := cfg.metrics.(ObjectiveMetrics); !ok && cfg.meterProvider == nil && (cfg.apdex != nil || len(cfg.slos) > 0) {
+		return nil, errors.New("http_metrics: metrics do not implement ObjectiveMetrics required by Apdex and SLOs")
+	}
+	if cfg.maxNames <= 0 {
+		return nil, fmt.Errorf("http_metrics: max names %d is not positive", cfg.maxNames)
+	}
+	if cfg.apdex != nil && cfg.apdex.tolerating < cfg.apdex.satisfied {
+		return nil, fmt.Errorf("http_metrics: apdex tolerating threshold %s is lower than satisfied threshold %s",
+			cfg.apdex.tolerating, cfg.apdex.satisfied)
+	}
+	for _, s := range cfg.slos {
+		if s.objective <= 0 || s.objective > 1 {
+			return nil, fmt.Errorf("http_metrics: %s objective %v is not in (0, 1] range", s.name, s.objective)
+		}
 	}
 
-	return cfg
+	return cfg, nil
 }
 
-//newDefaultMetrics create new HTTPStats object and initializes metrics
-func newDefaultMetrics() Metrics {
+// newDefaultMetrics create new HTTPStats object and initializes metrics
+func newDefaultMetrics(cfg *metricsOptions) Metrics {
 	reqCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "http_requests_total",
-		Help: "number of requests",
-	}, []string{"code", "method"})
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "http_requests_total",
+		Help:        "number of requests",
+	}, cfg.requestLabels("code", "method"))
 
 	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name: "http_request_duration_seconds",
-		Help: "duration of a requests in seconds",
-	}, []string{"code", "method"})
+		Namespace:                       cfg.namespace,
+		Subsystem:                       cfg.subsystem,
+		ConstLabels:                     cfg.constLabels,
+		Name:                            "http_request_duration_seconds",
+		Help:                            "duration of a requests in seconds",
+		Buckets:                         cfg.buckets[DurationHistogram],
+		NativeHistogramBucketFactor:     cfg.nativeBucketFactor,
+		NativeHistogramMaxBucketNumber:  cfg.nativeMaxBuckets,
+		NativeHistogramMinResetDuration: cfg.nativeMinResetDuration,
+	}, cfg.requestLabels("code", "method"))
 
 	responseSize := prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name: "http_response_size_bytes",
-		Help: "size of the responses in bytes",
-	}, []string{"code", "method"})
+		Namespace:                       cfg.namespace,
+		Subsystem:                       cfg.subsystem,
+		ConstLabels:                     cfg.constLabels,
+		Name:                            "http_response_size_bytes",
+		Help:                            "size of the responses in bytes",
+		Buckets:                         cfg.buckets[ResponseSizeHistogram],
+		NativeHistogramBucketFactor:     cfg.nativeBucketFactor,
+		NativeHistogramMaxBucketNumber:  cfg.nativeMaxBuckets,
+		NativeHistogramMinResetDuration: cfg.nativeMinResetDuration,
+	}, cfg.requestLabels("code", "method"))
+
+	uncompressed := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:                       cfg.namespace,
+		Subsystem:                       cfg.subsystem,
+		ConstLabels:                     cfg.constLabels,
+		Name:                            "http_response_uncompressed_size_bytes",
+		Help:                            "size of the responses before the content encoding (eg. compression) in bytes",
+		Buckets:                         cfg.buckets[UncompressedResponseSizeHistogram],
+		NativeHistogramBucketFactor:     cfg.nativeBucketFactor,
+		NativeHistogramMaxBucketNumber:  cfg.nativeMaxBuckets,
+		NativeHistogramMinResetDuration: cfg.nativeMinResetDuration,
+	}, cfg.requestLabels("code", "method"))
 
 	requestSize := prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name: "http_request_size_bytes",
-		Help: "size of the requests in bytes",
-	}, []string{"code", "method"})
+		Namespace:                       cfg.namespace,
+		Subsystem:                       cfg.subsystem,
+		ConstLabels:                     cfg.constLabels,
+		Name:                            "http_request_size_bytes",
+		Help:                            "size of the requests in bytes",
+		Buckets:                         cfg.buckets[RequestSizeHistogram],
+		NativeHistogramBucketFactor:     cfg.nativeBucketFactor,
+		NativeHistogramMaxBucketNumber:  cfg.nativeMaxBuckets,
+		NativeHistogramMinResetDuration: cfg.nativeMinResetDuration,
+	}, cfg.requestLabels("code", "method"))
 
 	timeToWrite := prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name: "http_time_to_write_seconds",
-		Help: "tracks how long it took to write all response headers in seconds",
-	}, []string{"code", "method"})
+		Namespace:                       cfg.namespace,
+		Subsystem:                       cfg.subsystem,
+		ConstLabels:                     cfg.constLabels,
+		Name:                            "http_time_to_write_seconds",
+		Help:                            "tracks how long it took to write all response headers in seconds",
+		Buckets:                         cfg.buckets[TimeToWriteHistogram],
+		NativeHistogramBucketFactor:     cfg.nativeBucketFactor,
+		NativeHistogramMaxBucketNumber:  cfg.nativeMaxBuckets,
+		NativeHistogramMinResetDuration: cfg.nativeMinResetDuration,
+	}, cfg.requestLabels("code", "method"))
 
 	handlerDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name: "http_handler_duration_seconds",
-		Help: "track how long it took to handle request in seconds",
-	}, []string{"code", "method", "handler_name"})
+		Namespace:                       cfg.namespace,
+		Subsystem:                       cfg.subsystem,
+		ConstLabels:                     cfg.constLabels,
+		Name:                            "http_handler_duration_seconds",
+		Help:                            "track how long it took to handle request in seconds",
+		Buckets:                         cfg.buckets[HandlerDurationHistogram],
+		NativeHistogramBucketFactor:     cfg.nativeBucketFactor,
+		NativeHistogramMaxBucketNumber:  cfg.nativeMaxBuckets,
+		NativeHistogramMinResetDuration: cfg.nativeMinResetDuration,
+	}, cfg.requestLabels("code", "method", "handler_name"))
 
 	handlerStatuses := prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "http_handler_statuses_total",
-		Help: "count number of responses per status bucket (2xx, 3xx, 4xx, 5xx)",
-	}, []string{"method", "status_bucket", "handler_name"})
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "http_handler_statuses_total",
+		Help:        "count number of responses per status bucket (2xx, 3xx, 4xx, 5xx)",
+	}, cfg.requestLabels("method", "status_bucket", "handler_name"))
+
+	inFlight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "http_handler_requests_in_flight",
+		Help:        "number of requests currently being handled",
+	}, []string{"handler_name"})
+
+	maxInFlight := NewPeakGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "http_handler_requests_in_flight_max",
+		Help:        "maximum number of concurrent requests since the last scrape",
+	})
+
+	queueWait := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:                       cfg.namespace,
+		Subsystem:                       cfg.subsystem,
+		ConstLabels:                     cfg.constLabels,
+		Name:                            "http_handler_queue_wait_seconds",
+		Help:                            "time requests spent waiting in a concurrency limiter queue in seconds",
+		Buckets:                         cfg.buckets[QueueWaitHistogram],
+		NativeHistogramBucketFactor:     cfg.nativeBucketFactor,
+		NativeHistogramMaxBucketNumber:  cfg.nativeMaxBuckets,
+		NativeHistogramMinResetDuration: cfg.nativeMinResetDuration,
+	}, []string{"handler_name"})
+
+	apdex := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "http_handler_apdex_requests_total",
+		Help:        "number of requests per Apdex zone (satisfied, tolerating, frustrated)",
+	}, []string{"handler_name", "apdex_zone"})
+
+	sloEvents := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "http_handler_slo_events_total",
+		Help:        "number of all events per service level objective",
+	}, []string{"handler_name", "slo"})
+
+	sloGoodEvents := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "http_handler_slo_good_events_total",
+		Help:        "number of good events per service level objective",
+	}, []string{"handler_name", "slo"})
+
+	sloObjective := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "http_handler_slo_objective_ratio",
+		Help:        "expected ratio of good events to all events per service level objective",
+	}, []string{"handler_name", "slo"})
 
 	return defaultMetrics{totalRequests: reqCounter, duration: duration, responseSize: responseSize,
-		requestSize: requestSize, timeToWrite: timeToWrite, handlerDuration: handlerDuration,
-		handlerStatuses: handlerStatuses}
+		uncompressed: uncompressed, requestSize: requestSize, timeToWrite: timeToWrite, handlerDuration: handlerDuration,
+		handlerStatuses: handlerStatuses, inFlight: inFlight, maxInFlight: maxInFlight, queueWait: queueWait,
+		routes: cfg.routeLimiter(), apdex: apdex, sloEvents: sloEvents, sloGoodEvents: sloGoodEvents,
+		sloObjective: sloObjective}
 }
 
 // Describe implements prometheus Collector interface.
@@ -167,9 +395,20 @@ func (s defaultMetrics) Describe(in chan<- *prometheus.Desc) {
 	s.totalRequests.Describe(in)
 	s.requestSize.Describe(in)
 	s.responseSize.Describe(in)
+	s.uncompressed.Describe(in)
 	s.timeToWrite.Describe(in)
 	s.handlerDuration.Describe(in)
 	s.handlerStatuses.Describe(in)
+	s.inFlight.Describe(in)
+	s.maxInFlight.Describe(in)
+	s.queueWait.Describe(in)
+	s.apdex.Describe(in)
+	s.sloEvents.Describe(in)
+	s.sloGoodEvents.Describe(in)
+	s.sloObjective.Describe(in)
+	if s.routes != nil {
+		s.routes.Describe(in)
+	}
 }
 
 // Collect implements prometheus Collector interface.
@@ -178,69 +417,183 @@ func (s defaultMetrics) Collect(in chan<- prometheus.Metric) {
 	s.totalRequests.Collect(in)
 	s.requestSize.Collect(in)
 	s.responseSize.Collect(in)
+	s.uncompressed.Collect(in)
 	s.timeToWrite.Collect(in)
 	s.handlerDuration.Collect(in)
 	s.handlerStatuses.Collect(in)
+	s.inFlight.Collect(in)
+	s.maxInFlight.Collect(in)
+	s.queueWait.Collect(in)
+	s.apdex.Collect(in)
+	s.sloEvents.Collect(in)
+	s.sloGoodEvents.Collect(in)
+	s.sloObjective.Collect(in)
+	if s.routes != nil {
+		s.routes.Collect(in)
+	}
 }
 
-//RegisterDefaultMetrics will register default HttpStats metrics instance in Prometheus. This is only needed if
+// RegisterDefaultMetrics will register default HttpStats metrics instance in Prometheus. This is only needed if
 // any handlers are instrumented with default metrics (not overridden by WithMetrics() option)
 func RegisterDefaultMetrics(registerer prometheus.Registerer) error {
 	return registerer.Register(basicMetrics)
 }
 
-//UnregisterDefaultMetrics is a companion function to RegisterDefaultMetrics and must be called if RegisterDefaultMetrics
+// UnregisterDefaultMetrics is a companion function to RegisterDefaultMetrics and must be called if RegisterDefaultMetrics
 // is used to cleanup the metrics in Prometheus
 func UnregisterDefaultMetrics(registerer prometheus.Registerer) {
 	registerer.Unregister(basicMetrics)
 }
 
-//Measured will instrument any http.HandlerFunc with custom metrics (with custom label "handler_name")
-//This is useful for gathering per-handler metrics to implement Apdex-like alerting
+// Measured will instrument any http.HandlerFunc with custom metrics (with custom label "handler_name")
+// This is useful for gathering per-handler metrics to implement Apdex-like alerting (see: WithApdex, WithAvailabilitySLO
+// and WithLatencySLO options). Measured panics if the options are invalid, use MeasuredE to handle the error.
 func Measured(options ...Option) middlewares.Middleware {
+	fn, err := MeasuredE(options...)
+	if err != nil {
+		panic(err)
+	}
+
+	return fn
+}
+
+// MeasuredE works like Measured but returns an error if the options are invalid
+func MeasuredE(options ...Option) (middlewares.Middleware, error) {
+	cfg, err := newOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+
 	fn := func(h http.Handler) http.Handler {
-		o := newOptions(options...)
+		o := *cfg
+		if len(o.handlerName) == 0 {
+			o.handlerName = handlerFuncName(h)
+		}
+		if o.meterProvider != nil {
+			return newOTelInstrumentation(&o).handler(h)
+		}
+		instrumented := newInstrumentations(&o)
 
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			wrapped := promhttp.InstrumentHandlerResponseSize(o.metrics.GetResponseSize(), h)
-			wrapped = promhttp.InstrumentHandlerCounter(o.metrics.GetTotalRequests(), wrapped)
-			wrapped = promhttp.InstrumentHandlerDuration(o.metrics.GetDuration(), wrapped)
-			wrapped = promhttp.InstrumentHandlerDuration(o.metrics.GetHandlerDuration().MustCurryWith(prometheus.Labels{"handler_name": o.handlerName}), wrapped)
-			wrapped = promhttp.InstrumentHandlerRequestSize(o.metrics.GetRequestSize(), wrapped)
-			wrapped = promhttp.InstrumentHandlerTimeToWriteHeader(o.metrics.GetTimeToWrite(), wrapped)
-			wrapped = instrumentPrometheus(o.handlerName, o.metrics.GetHandlerStatuses(), wrapped)
-
-			wrapped.ServeHTTP(w, r)
+			i := instrumented.get(r)
+			if i.concurrency {
+				i.inFlight.Inc()
+				i.maxInFlight.Inc()
+				defer i.inFlight.Dec()
+				defer i.maxInFlight.Dec()
+			}
+
+			ctx, wait := middlewares.WithQueueWait(r.Context())
+			ctx, encoding := middlewares.WithEncodingStats(ctx)
+			r = r.WithContext(ctx)
+
+			requestSize := approximateRequestSize(r)
+			rec := &responseRecorder{ResponseWriter: w}
+			start := time.Now()
+			h.ServeHTTP(rec, r)
+
+			i.observe(r, rec, start, requestSize, encoding)
+			if d, ok := wait.Get(); ok && i.concurrency {
+				i.queueWait.Observe(d.Seconds())
+			}
 		})
 	}
 
-	return fn
+	return fn, nil
 }
 
-//instrumentPrometheus will register prometheus metrics on a given http.Handler
-func instrumentPrometheus(handlerName string, metric *prometheus.CounterVec, next http.Handler) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		d := statusRecorder{w, 200}
-		next.ServeHTTP(&d, r)
+// instrumentation holds metrics prepared for a single handler when it is wrapped
+type instrumentation struct {
+	metrics         Metrics
+	handlerName     string
+	route           RouteExtractor
+	routes          *RouteLimiter
+	exemplar        ExemplarGetter
+	handlerDuration prometheus.ObserverVec
+	handlerStatuses *prometheus.CounterVec
+	concurrency     bool
+	inFlight        prometheus.Gauge
+	maxInFlight     *PeakGauge
+	queueWait       prometheus.Observer
+	codeLabel       StatusLabeler
+	bucketLabel     StatusLabeler
+	apdex           *apdexThresholds
+	apdexZones      map[string]prometheus.Counter
+	slos            []sloInstrumentation
+}
 
-		labels := prometheus.Labels{
-			"method":       r.Method,
-			"handler_name": handlerName,
+func newInstrumentation(o *options) *instrumentation {
+	handlerLabels := prometheus.Labels{"handler_name": o.handlerName}
+
+	i := &instrumentation{
+		metrics:         o.metrics,
+		handlerName:     o.handlerName,
+		route:           o.route,
+		exemplar:        o.exemplar,
+		handlerDuration: o.metrics.GetHandlerDuration().MustCurryWith(handlerLabels),
+		handlerStatuses: o.metrics.GetHandlerStatuses().MustCurryWith(handlerLabels),
+		codeLabel:       ExactStatus,
+		bucketLabel:     StatusClass,
+		apdex:           o.apdex,
+	}
+	if metrics, ok := o.metrics.(RouteMetrics); ok {
+		i.routes = metrics.GetRoutes()
+	}
+	if metrics, ok := o.metrics.(ConcurrencyMetrics); ok {
+		i.concurrency = true
+		i.inFlight = metrics.GetInFlight().With(handlerLabels)
+		i.maxInFlight = metrics.GetMaxInFlight().WithHandler(o.handlerName)
+		i.queueWait = metrics.GetQueueWait().With(handlerLabels)
+	}
+	if o.statusLabel != nil {
+		i.codeLabel = o.statusLabel
+		i.bucketLabel = o.statusLabel
+	}
+	if metrics, ok := o.metrics.(ObjectiveMetrics); ok {
+		i.slos = newSLOInstrumentation(metrics, o.handlerName, o.slos)
+		if o.apdex != nil {
+			i.apdexZones = newApdexInstrumentation(metrics, o.handlerName)
 		}
+	}
+
+	return i
+}
 
-		switch {
-		case d.status >= 200 && d.status <= 299:
-			labels["status_bucket"] = "2xx"
-		case d.status >= 300 && d.status <= 399:
-			labels["status_bucket"] = "3xx"
-		case d.status >= 400 && d.status <= 499:
-			labels["status_bucket"] = "4xx"
-		case d.status >= 500 && d.status <= 599:
-			labels["status_bucket"] = "5xx"
-		default:
-			labels["status_bucket"] = "unknown"
+// observe records all the metrics of a handled request
+func (i *instrumentation) observe(r *http.Request, rec *responseRecorder, start time.Time, requestSize int64,
+	encoding *middlewares.EncodingStats) {
+	elapsed := time.Since(start)
+	duration := elapsed.Seconds()
+	status := responseStatus(r, rec)
+	labels := prometheus.Labels{"code": i.codeLabel(status), "method": methodLabel(r.Method)}
+	statusLabels := prometheus.Labels{"method": methodLabel(r.Method), "status_bucket": i.bucketLabel(status)}
+	if i.routes != nil {
+		route := i.routeLabel(r)
+		labels["route"] = route
+		statusLabels["route"] = route
+	}
+
+	var exemplar prometheus.Labels
+	if i.exemplar != nil {
+		exemplar = i.exemplar(r.Context())
+	}
+
+	addWithExemplar(i.metrics.GetTotalRequests().With(labels), 1, exemplar)
+	observeWithExemplar(i.metrics.GetDuration().With(labels), duration, exemplar)
+	observeWithExemplar(i.handlerDuration.With(labels), duration, exemplar)
+	observeWithExemplar(i.metrics.GetRequestSize().With(labels), float64(requestSize), exemplar)
+	observeWithExemplar(i.metrics.GetResponseSize().With(labels), float64(rec.written), exemplar)
+	if metrics, ok := i.metrics.(CompressionMetrics); ok {
+		uncompressed := rec.written
+		if _, size, _, ok := encoding.Get(); ok {
+			uncompressed = size
 		}
+		observeWithExemplar(metrics.GetUncompressedResponseSize().With(labels), float64(uncompressed), exemplar)
+	}
+	if rec.headerWritten {
+		observeWithExemplar(i.metrics.GetTimeToWrite().With(labels), rec.headerTime.Sub(start).Seconds(), exemplar)
+	}
 
-		metric.With(labels).Inc()
-	})
-}
\ No newline at end of file
+	addWithExemplar(i.handlerStatuses.With(statusLabels), 1, exemplar)
+	i.observeObjectives(status, elapsed)
+}
@@ -2,11 +2,13 @@ package http_metrics
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,5 +45,58 @@ func TestHttpStats4xx(t *testing.T) {
 	assert.Contains(t, metrics, `http_response_size_bytes_count{code="403",method="get"} 1`, "http_response_size_bytes_count did not increment for 403 statuses")
 	assert.Contains(t, metrics, `http_time_to_write_seconds_bucket{code="403",method="get",le="1"} 1`, "http_time_to_write_seconds_bucket did not increment for 403 statuses")
 	assert.Contains(t, metrics, `http_time_to_write_seconds_count{code="403",method="get"} 1`, "http_time_to_write_seconds_count did not increment for 403 statuses")
-	assert.Contains(t, metrics, `http_handler_statuses_total{handler_name="error_handler",method="GET",status_bucket="4xx"} 1`, "http_handler_statuses_total did not increment for 403 statuses")
+	assert.Contains(t, metrics, `http_handler_statuses_total{handler_name="error_handler",method="get",status_bucket="4xx"} 1`, "http_handler_statuses_total did not increment for 403 statuses")
+}
+
+// stackedMeasured reproduces the previous implementation of Measured (promhttp wrappers built per request) and
+// serves as a baseline for benchmarks
+func stackedMeasured(handlerName string, metrics Metrics, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wrapped := promhttp.InstrumentHandlerResponseSize(metrics.GetResponseSize(), h)
+		wrapped = promhttp.InstrumentHandlerCounter(metrics.GetTotalRequests(), wrapped)
+		wrapped = promhttp.InstrumentHandlerDuration(metrics.GetDuration(), wrapped)
+		wrapped = promhttp.InstrumentHandlerDuration(metrics.GetHandlerDuration().MustCurryWith(prometheus.Labels{"handler_name": handlerName}), wrapped)
+		wrapped = promhttp.InstrumentHandlerRequestSize(metrics.GetRequestSize(), wrapped)
+		wrapped = promhttp.InstrumentHandlerTimeToWriteHeader(metrics.GetTimeToWrite(), wrapped)
+		wrapped.ServeHTTP(w, r)
+	})
+}
+
+func benchmarkHandler(b *testing.B, handler http.Handler) {
+	req := httptest.NewRequest("GET", "/benchmark", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkMeasured(b *testing.B) {
+	benchmarkHandler(b, Measured(WithName("bench"), WithMetrics(newDefaultMetrics(&metricsOptions{})))(http.HandlerFunc(testHandlerFunc)))
+}
+
+func BenchmarkStackedPromhttp(b *testing.B) {
+	benchmarkHandler(b, stackedMeasured("bench", newDefaultMetrics(&metricsOptions{}), http.HandlerFunc(testHandlerFunc)))
+}
+
+func testHandlerFunc(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func TestCompressionMetricsOptional(t *testing.T) {
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	assert.NoError(t, err, "could not create metrics")
+
+	handler := Measured(WithName("custom"), WithMetrics(customMetrics{metrics}))(http.HandlerFunc(testHandlerFunc))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.GetResponseSize()), "response size not observed")
+	assert.Zero(t, testutil.CollectAndCount(metrics.(CompressionMetrics).GetUncompressedResponseSize()),
+		"uncompressed response size should not be observed")
+}
+
+// customMetrics hides the optional interfaces of the metrics like custom collectors implementing only Metrics
+type customMetrics struct {
+	Metrics
 }
@@ -0,0 +1,146 @@
+package http_metrics
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Histogram identifies one of the histograms created by NewMetrics
+type Histogram int
+
+const (
+	// DurationHistogram is the "http_request_duration_seconds" histogram
+	DurationHistogram Histogram = iota
+	// HandlerDurationHistogram is the "http_handler_duration_seconds" histogram
+	HandlerDurationHistogram
+	// TimeToWriteHistogram is the "http_time_to_write_seconds" histogram
+	TimeToWriteHistogram
+	// RequestSizeHistogram is the "http_request_size_bytes" histogram
+	RequestSizeHistogram
+	// ResponseSizeHistogram is the "http_response_size_bytes" histogram
+	ResponseSizeHistogram
+	// QueueWaitHistogram is the "http_handler_queue_wait_seconds" histogram
+	QueueWaitHistogram
+	// UncompressedResponseSizeHistogram is the "http_response_uncompressed_size_bytes" histogram
+	UncompressedResponseSizeHistogram
+)
+
+// DefaultDurationBuckets are latency buckets (in seconds) aligned with common SLO thresholds, starting from
+// sub-millisecond values
+var DefaultDurationBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are size buckets (in bytes) ranging from 64B to 16MB
+var DefaultSizeBuckets = prometheus.ExponentialBuckets(64, 4, 10)
+
+type metricsOptions struct {
+	namespace   string
+	subsystem   string
+	constLabels prometheus.Labels
+	buckets     map[Histogram][]float64
+	routeLabel  bool
+	maxRoutes   int
+
+	nativeBucketFactor     float64
+	nativeMaxBuckets       uint32
+	nativeMinResetDuration time.Duration
+}
+
+// MetricsOption represents an option of the metrics created by NewMetrics
+type MetricsOption func(*metricsOptions)
+
+// WithNamespace sets the namespace (prefix) of all metric names
+func WithNamespace(namespace string) MetricsOption {
+	return func(o *metricsOptions) {
+		o.namespace = namespace
+	}
+}
+
+// WithSubsystem sets the subsystem of all metric names (placed between the namespace and the name)
+func WithSubsystem(subsystem string) MetricsOption {
+	return func(o *metricsOptions) {
+		o.subsystem = subsystem
+	}
+}
+
+// WithConstLabels sets labels with constant values added to all metrics
+func WithConstLabels(labels prometheus.Labels) MetricsOption {
+	return func(o *metricsOptions) {
+		o.constLabels = labels
+	}
+}
+
+// WithBuckets sets the buckets of a given histogram
+func WithBuckets(histogram Histogram, buckets []float64) MetricsOption {
+	return func(o *metricsOptions) {
+		o.buckets[histogram] = buckets
+	}
+}
+
+// WithNativeHistograms enables Prometheus native (sparse) histograms for all duration and size metrics. Classic
+// buckets are still exposed for scrapers that do not support native histograms. Bucket factor defines the
+// maximum growth of a bucket width (e.g. 1.1 for at most 10% of the relative error), maxBuckets limits number of
+// sparse buckets per histogram (resolution is reduced when exceeded).
+func WithNativeHistograms(bucketFactor float64, maxBuckets uint32) MetricsOption {
+	return func(o *metricsOptions) {
+		o.nativeBucketFactor = bucketFactor
+		o.nativeMaxBuckets = maxBuckets
+		o.nativeMinResetDuration = time.Hour
+	}
+}
+
+// LinearBuckets creates count buckets, each width wide, where the lowest bucket has an upper bound of start
+func LinearBuckets(start, width float64, count int) []float64 {
+	return prometheus.LinearBuckets(start, width, count)
+}
+
+// ExponentialBuckets creates count buckets, where the lowest bucket has an upper bound of start and each following
+// bucket's upper bound is factor times the previous bucket's upper bound
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	return prometheus.ExponentialBuckets(start, factor, count)
+}
+
+// SLOBuckets creates latency buckets with upper bounds exactly matching given SLO thresholds so the ratio of
+// requests meeting the objective can be computed without interpolation
+func SLOBuckets(thresholds ...time.Duration) []float64 {
+	buckets := make([]float64, 0, len(thresholds))
+	for _, threshold := range thresholds {
+		buckets = append(buckets, threshold.Seconds())
+	}
+	sort.Float64s(buckets)
+	return buckets
+}
+
+// NewMetrics creates new Metrics container that can be passed to Measured using WithMetrics option. If registerer
+// is not nil the metrics are registered in it. An error is returned if the options are invalid.
+func NewMetrics(registerer prometheus.Registerer, options ...MetricsOption) (Metrics, error) {
+	cfg := &metricsOptions{
+		buckets: map[Histogram][]float64{
+			DurationHistogram:                 DefaultDurationBuckets,
+			HandlerDurationHistogram:          DefaultDurationBuckets,
+			TimeToWriteHistogram:              DefaultDurationBuckets,
+			RequestSizeHistogram:              DefaultSizeBuckets,
+			ResponseSizeHistogram:             DefaultSizeBuckets,
+			QueueWaitHistogram:                DefaultDurationBuckets,
+			UncompressedResponseSizeHistogram: DefaultSizeBuckets,
+		},
+	}
+
+	for _, o := range options {
+		o(cfg)
+	}
+	if cfg.routeLabel && cfg.maxRoutes <= 0 {
+		return nil, fmt.Errorf("http_metrics: max routes %d is not positive", cfg.maxRoutes)
+	}
+
+	metrics := newDefaultMetrics(cfg)
+	if registerer != nil {
+		if err := registerer.Register(metrics); err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
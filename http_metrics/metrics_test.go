@@ -0,0 +1,37 @@
+package http_metrics
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	orders, err := NewMetrics(registry, WithNamespace("orders"), WithSubsystem("api"),
+		WithConstLabels(prometheus.Labels{"zone": "eu"}),
+		WithBuckets(HandlerDurationHistogram, SLOBuckets(100*time.Millisecond, 5*time.Millisecond)),
+		WithBuckets(RequestSizeHistogram, LinearBuckets(100, 100, 3)))
+	assert.NoError(t, err, "could not create metrics")
+	billing, err := NewMetrics(registry, WithNamespace("billing"))
+	assert.NoError(t, err, "metrics with different namespaces should not collide")
+	_, err = NewMetrics(registry, WithNamespace("billing"))
+	assert.Error(t, err, "duplicated metrics should not be registered")
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	assert.HTTPSuccess(t, Measured(WithName("orders"), WithMetrics(orders))(okHandler).ServeHTTP, "GET", "/", url.Values{})
+	assert.HTTPSuccess(t, Measured(WithName("billing"), WithMetrics(billing))(okHandler).ServeHTTP, "GET", "/", url.Values{})
+
+	metrics := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, metrics, `orders_api_http_requests_total{code="200",method="get",zone="eu"} 1`, "namespace, subsystem or const labels not applied")
+	assert.Contains(t, metrics, `billing_http_requests_total{code="200",method="get"} 1`, "namespace not applied")
+	assert.Contains(t, metrics, `orders_api_http_handler_duration_seconds_bucket{code="200",handler_name="orders",method="get",zone="eu",le="0.005"} 1`, "SLO buckets not applied")
+	assert.Contains(t, metrics, `orders_api_http_request_size_bytes_bucket{code="200",method="get",zone="eu",le="300"} 1`, "linear buckets not applied")
+	assert.Contains(t, metrics, `billing_http_request_duration_seconds_bucket{code="200",method="get",le="0.0001"}`, "default sub-millisecond buckets not applied")
+}
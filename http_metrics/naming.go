@@ -0,0 +1,111 @@
+package http_metrics
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"sync"
+)
+
+// DefaultMaxNames is the default number of distinct handler names returned by the namer that are tracked
+const DefaultMaxNames = 100
+
+// OtherName is the "handler_name" label value used for names exceeding the cardinality limit
+const OtherName = "other"
+
+// HandlerNamer returns the "handler_name" label value for a request. Empty name means that the name set by WithName
+// (or derived from the wrapped handler) should be used.
+type HandlerNamer func(r *http.Request) string
+
+// PatternName uses the pattern of the http.ServeMux route that matched the request (Go 1.22+). The pattern is only
+// available if Measured wraps handlers registered in the router (not the router itself).
+func PatternName(r *http.Request) string {
+	return r.Pattern
+}
+
+// WithNamer sets the function used to get the handler name of each request. Namer is called before the request is
+// handled and should return values of bounded cardinality as every name creates separate metric series. At most
+// DefaultMaxNames distinct names are tracked (see: WithMaxNames), unseen names above the limit are collapsed into
+// OtherName.
+func WithNamer(namer HandlerNamer) Option {
+	return func(o *options) {
+		o.namer = namer
+	}
+}
+
+// WithMaxNames sets the maximum number of distinct handler names returned by the namer (DefaultMaxNames by default)
+func WithMaxNames(maxNames int) Option {
+	return func(o *options) {
+		o.maxNames = maxNames
+	}
+}
+
+// handlerFuncName derives the handler name from the name of the wrapped function or the type of the wrapped handler
+func handlerFuncName(h http.Handler) string {
+	v := reflect.ValueOf(h)
+	if v.Kind() == reflect.Func {
+		if fn := runtime.FuncForPC(v.Pointer()); fn != nil {
+			return fn.Name()
+		}
+	}
+
+	return v.Type().String()
+}
+
+// instrumentations holds instrumentation of the wrapped handler and instrumentations of all the names returned by
+// the namer
+type instrumentations struct {
+	options *options
+	static  *instrumentation
+	lock    sync.RWMutex
+	names   map[string]*instrumentation
+}
+
+func newInstrumentations(o *options) *instrumentations {
+	return &instrumentations{
+		options: o,
+		static:  newInstrumentation(o),
+		names:   map[string]*instrumentation{},
+	}
+}
+
+// get returns instrumentation for a given request
+func (s *instrumentations) get(r *http.Request) *instrumentation {
+	if s.options.namer == nil {
+		return s.static
+	}
+
+	return s.named(s.options.namer(r))
+}
+
+// named returns instrumentation for a given handler name
+func (s *instrumentations) named(name string) *instrumentation {
+	if len(name) == 0 || name == s.options.handlerName {
+		return s.static
+	}
+
+	s.lock.RLock()
+	i, ok := s.names[name]
+	s.lock.RUnlock()
+	if ok {
+		return i
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if i, ok = s.names[name]; ok {
+		return i
+	}
+	if len(s.names) >= s.options.maxNames {
+		name = OtherName
+		if i, ok = s.names[name]; ok {
+			return i
+		}
+	}
+	o := *s.options
+	o.handlerName = name
+	i = newInstrumentation(&o)
+	s.names[name] = i
+
+	return i
+}
@@ -0,0 +1,72 @@
+package http_metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func listItems(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestHandlerFuncName(t *testing.T) {
+	assert.Equal(t, "github.com/harnash/go-middlewares/http_metrics.listItems", handlerFuncName(http.HandlerFunc(listItems)), "invalid function name")
+	assert.Equal(t, "*http.ServeMux", handlerFuncName(http.NewServeMux()), "invalid handler type name")
+}
+
+func TestMeasuredNaming(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	assert.NoError(t, err, "could not create metrics")
+
+	measured, err := MeasuredE(WithMetrics(metrics))
+	assert.NoError(t, err, "handler name should be optional")
+	measured(http.HandlerFunc(listItems)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	router := http.NewServeMux()
+	router.Handle("GET /users/{id}", Measured(WithMetrics(metrics), WithNamer(PatternName))(http.HandlerFunc(listItems)))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/1", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/2", nil))
+
+	body := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, body, `http_handler_statuses_total{handler_name="github.com/harnash/go-middlewares/http_metrics.listItems",method="get",status_bucket="2xx"} 1`, "handler name not derived from function name")
+	assert.Contains(t, body, `http_handler_statuses_total{handler_name="GET /users/{id}",method="get",status_bucket="2xx"} 2`, "handler name not taken from the pattern")
+}
+
+func TestMeasuredMaxNames(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	assert.NoError(t, err, "could not create metrics")
+
+	handler := Measured(WithName("static"), WithMetrics(metrics), WithMaxNames(2),
+		WithNamer(func(r *http.Request) string { return r.URL.Path }))(http.HandlerFunc(listItems))
+	for _, path := range []string{"/a", "/b", "/a", "/c", "/d"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	body := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, body, `http_handler_statuses_total{handler_name="/a",method="get",status_bucket="2xx"} 2`, "name below the limit not tracked")
+	assert.Contains(t, body, `http_handler_statuses_total{handler_name="/b",method="get",status_bucket="2xx"} 1`, "name below the limit not tracked")
+	assert.Contains(t, body, `http_handler_statuses_total{handler_name="other",method="get",status_bucket="2xx"} 2`, "names above the limit not collapsed")
+	assert.NotContains(t, body, `handler_name="/c"`, "name above the limit should not be tracked")
+}
+
+func TestMeasuredE(t *testing.T) {
+	_, err := MeasuredE(WithMetrics(nil))
+	assert.Error(t, err, "missing metrics not reported")
+	_, err = MeasuredE(WithApdex(time.Second, time.Millisecond))
+	assert.Error(t, err, "invalid apdex thresholds not reported")
+	_, err = MeasuredE(WithAvailabilitySLO(99.9))
+	assert.Error(t, err, "invalid objective not reported")
+	_, err = MeasuredE(WithNamer(PatternName), WithMaxNames(0))
+	assert.Error(t, err, "invalid max names not reported")
+
+	assert.Panics(t, func() { Measured(WithLatencySLO(time.Second, 0)) }, "Measured should panic on invalid options")
+}
@@ -0,0 +1,189 @@
+package http_metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// meterName is the instrumentation scope name of the OpenTelemetry instruments
+const meterName = "github.com/harnash/go-middlewares/http_metrics"
+
+// DefaultOTelDurationBuckets are the explicit bucket boundaries (in seconds) advised by the OpenTelemetry semantic
+// conventions for the "http.server.request.duration" histogram
+var DefaultOTelDurationBuckets = []float64{.005, .01, .025, .05, .075, .1, .25, .5, .75, 1, 2.5, 5, 7.5, 10}
+
+// WithMeterProvider switches Measured to the OpenTelemetry backend. Instead of the Prometheus metrics, handled requests
+// are recorded by the semantic conventions instruments: "http.server.request.duration",
+// "http.server.active_requests", "http.server.request.body.size" and "http.server.response.body.size".
+// Errors creating the instruments are reported to the global OpenTelemetry error handler. Options specific to the
+// Prometheus metrics (WithApdex, WithAvailabilitySLO, WithLatencySLO, WithStatusLabels and WithNamer) are not
+// supported and MeasuredE returns an error if they are combined with the meter provider.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(o *options) {
+		o.meterProvider = provider
+	}
+}
+
+// otelInstrumentation holds OpenTelemetry instruments prepared for a single handler when it is wrapped
+type otelInstrumentation struct {
+	route           RouteExtractor
+	duration        metric.Float64Histogram
+	activeRequests  metric.Int64UpDownCounter
+	requestBodySize metric.Int64Histogram
+	responseSize    metric.Int64Histogram
+}
+
+func newOTelInstrumentation(o *options) *otelInstrumentation {
+	meter := o.meterProvider.Meter(meterName)
+
+	duration, err := meter.Float64Histogram(semconv.HTTPServerRequestDurationName,
+		metric.WithUnit(semconv.HTTPServerRequestDurationUnit),
+		metric.WithDescription(semconv.HTTPServerRequestDurationDescription),
+		metric.WithExplicitBucketBoundaries(DefaultOTelDurationBuckets...))
+	handleError(err)
+
+	activeRequests, err := meter.Int64UpDownCounter(semconv.HTTPServerActiveRequestsName,
+		metric.WithUnit(semconv.HTTPServerActiveRequestsUnit),
+		metric.WithDescription(semconv.HTTPServerActiveRequestsDescription))
+	handleError(err)
+
+	requestBodySize, err := meter.Int64Histogram(semconv.HTTPServerRequestBodySizeName,
+		metric.WithUnit(semconv.HTTPServerRequestBodySizeUnit),
+		metric.WithDescription(semconv.HTTPServerRequestBodySizeDescription))
+	handleError(err)
+
+	responseSize, err := meter.Int64Histogram(semconv.HTTPServerResponseBodySizeName,
+		metric.WithUnit(semconv.HTTPServerResponseBodySizeUnit),
+		metric.WithDescription(semconv.HTTPServerResponseBodySizeDescription))
+	handleError(err)
+
+	return &otelInstrumentation{
+		route:           o.route,
+		duration:        duration,
+		activeRequests:  activeRequests,
+		requestBodySize: requestBodySize,
+		responseSize:    responseSize,
+	}
+}
+
+// handleError reports the error creating the instrument to the global OpenTelemetry error handler
+func handleError(err error) {
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// handler wraps given handler recording the OpenTelemetry instruments
+func (i *otelInstrumentation) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		active := metric.WithAttributes(otelMethod(r.Method), semconv.URLSchemeKey.String(otelScheme(r)))
+		i.activeRequests.Add(ctx, 1, active)
+		defer i.activeRequests.Add(ctx, -1, active)
+
+		requestSize := r.ContentLength
+		var body *countingBody
+		if requestSize < 0 && r.Body != nil && r.Body != http.NoBody {
+			body = &countingBody{ReadCloser: r.Body}
+			r.Body = body
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		start := time.Now()
+		h.ServeHTTP(rec, r)
+		duration := time.Since(start).Seconds()
+
+		if body != nil {
+			requestSize = body.read.Load()
+		} else if requestSize < 0 {
+			requestSize = 0
+		}
+
+		attributes := metric.WithAttributeSet(i.attributes(r, responseStatus(r, rec)))
+		i.duration.Record(ctx, duration, attributes)
+		i.requestBodySize.Record(ctx, requestSize, attributes)
+		i.responseSize.Record(ctx, rec.written, attributes)
+	})
+}
+
+// attributes returns semantic conventions attributes of a handled request
+func (i *otelInstrumentation) attributes(r *http.Request, status int) attribute.Set {
+	attributes := []attribute.KeyValue{
+		otelMethod(r.Method),
+		semconv.URLSchemeKey.String(otelScheme(r)),
+		semconv.HTTPResponseStatusCode(status),
+		semconv.NetworkProtocolName("http"),
+		semconv.NetworkProtocolVersion(otelProtocolVersion(r)),
+	}
+
+	var route string
+	if i.route != nil {
+		route = i.route(r)
+	} else {
+		route = PatternRoute(r)
+	}
+	// ServeMux patterns might be prefixed with the method which is a separate attribute
+	if idx := strings.IndexByte(route, ' '); idx >= 0 {
+		route = strings.TrimLeft(route[idx:], " ")
+	}
+	if len(route) > 0 {
+		attributes = append(attributes, semconv.HTTPRoute(route))
+	}
+
+	if status >= http.StatusInternalServerError {
+		attributes = append(attributes, semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+	}
+
+	return attribute.NewSet(attributes...)
+}
+
+// otelMethod returns the "http.request.method" attribute limiting it to the standard methods
+func otelMethod(method string) attribute.KeyValue {
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodHead, http.MethodPost, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace, http.MethodPatch:
+		return semconv.HTTPRequestMethodKey.String(method)
+	default:
+		return semconv.HTTPRequestMethodOther
+	}
+}
+
+// otelScheme returns the scheme of the request as seen by the server
+func otelScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// otelProtocolVersion returns the HTTP version of the request in the format required by semantic conventions
+func otelProtocolVersion(r *http.Request) string {
+	if r.ProtoMajor >= 2 && r.ProtoMinor == 0 {
+		return strconv.Itoa(r.ProtoMajor)
+	}
+
+	return strconv.Itoa(r.ProtoMajor) + "." + strconv.Itoa(r.ProtoMinor)
+}
+
+// countingBody counts bytes read from the request body of unknown length
+type countingBody struct {
+	io.ReadCloser
+	read atomic.Int64
+}
+
+// Read implements io.Reader interface
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,123 @@
+package http_metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// findOTelMetric returns the metric with a given name collected by the reader
+func findOTelMetric(t *testing.T, reader sdkmetric.Reader, name string) metricdata.Metrics {
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm), "could not collect metrics")
+
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name == name {
+				return m
+			}
+		}
+	}
+
+	t.Fatalf("metric %q not found", name)
+	return metricdata.Metrics{}
+}
+
+func TestMeasuredOTel(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	var active int64
+	handler := Measured(WithName("items"), WithMeterProvider(provider))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sum := findOTelMetric(t, reader, "http.server.active_requests").Data.(metricdata.Sum[int64])
+		active = sum.DataPoints[0].Value
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("unavailable"))
+	}))
+
+	router := http.NewServeMux()
+	router.Handle("POST /items/{id}", handler)
+	req := httptest.NewRequest("POST", "/items/1", strings.NewReader("payload"))
+	req.ContentLength = -1
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, int64(1), active, "active requests not tracked")
+	sum := findOTelMetric(t, reader, "http.server.active_requests").Data.(metricdata.Sum[int64])
+	assert.Equal(t, int64(0), sum.DataPoints[0].Value, "active requests not decremented")
+
+	duration := findOTelMetric(t, reader, "http.server.request.duration")
+	assert.Equal(t, "s", duration.Unit, "invalid duration unit")
+	point := duration.Data.(metricdata.Histogram[float64]).DataPoints[0]
+	assert.Equal(t, uint64(1), point.Count, "duration not recorded")
+	assert.Equal(t, DefaultOTelDurationBuckets, point.Bounds, "advised buckets not applied")
+	expected := attribute.NewSet(
+		attribute.String("http.request.method", "POST"),
+		attribute.String("url.scheme", "http"),
+		attribute.Int("http.response.status_code", http.StatusServiceUnavailable),
+		attribute.String("network.protocol.name", "http"),
+		attribute.String("network.protocol.version", "1.1"),
+		attribute.String("http.route", "/items/{id}"),
+		attribute.String("error.type", "503"),
+	)
+	assert.Equal(t, expected, point.Attributes, "invalid attributes")
+
+	requestSize := findOTelMetric(t, reader, "http.server.request.body.size").Data.(metricdata.Histogram[int64])
+	assert.Equal(t, int64(len("payload")), requestSize.DataPoints[0].Sum, "request body size of unknown length not counted")
+	responseSize := findOTelMetric(t, reader, "http.server.response.body.size").Data.(metricdata.Histogram[int64])
+	assert.Equal(t, int64(len("unavailable")), responseSize.DataPoints[0].Sum, "response body size not recorded")
+}
+
+func TestMeasuredOTelClientClosed(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := Measured(WithName("items"), WithMeterProvider(provider))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+
+	point := findOTelMetric(t, reader, "http.server.request.duration").Data.(metricdata.Histogram[float64]).DataPoints[0]
+	status, _ := point.Attributes.Value("http.response.status_code")
+	assert.Equal(t, int64(StatusClientClosedRequest), status.AsInt64(), "request cancelled by the client not reported")
+}
+
+func TestMeasuredOTelUnsupportedOptions(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	tests := map[string]Option{
+		"apdex":         WithApdex(time.Second, time.Minute),
+		"availability":  WithAvailabilitySLO(0.999),
+		"latency":       WithLatencySLO(time.Second, 0.99),
+		"status labels": WithStatusLabels(StatusClass),
+		"namer":         WithNamer(PatternName),
+	}
+	for name, option := range tests {
+		_, err := MeasuredE(WithName("items"), WithMeterProvider(provider), option)
+		assert.Error(t, err, "%s should not be accepted with meter provider", name)
+	}
+
+	handler, err := MeasuredE(WithName("items"), WithMeterProvider(provider))
+	if assert.NoError(t, err, "meter provider should be accepted") {
+		handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		point := findOTelMetric(t, reader, "http.server.request.duration").Data.(metricdata.Histogram[float64])
+		assert.Equal(t, uint64(1), point.DataPoints[0].Count, "request not recorded")
+	}
+}
+
+func TestOTelMethod(t *testing.T) {
+	assert.Equal(t, attribute.String("http.request.method", "PATCH"), otelMethod("PATCH"), "invalid method")
+	assert.Equal(t, attribute.String("http.request.method", "_OTHER"), otelMethod("PURGE"), "non-standard methods should be limited")
+}
@@ -0,0 +1,85 @@
+package http_metrics
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PeakGaugeVec is a gauge tracking the high-water mark of concurrent requests per handler ("handler_name" label).
+// The peak is reset to the current value every time the metric is collected, so each scrape reports the maximum
+// concurrency observed since the previous one.
+type PeakGaugeVec struct {
+	desc  *prometheus.Desc
+	lock  sync.RWMutex
+	peaks map[string]*PeakGauge
+}
+
+// PeakGauge tracks the concurrency of a single handler
+type PeakGauge struct {
+	current int64
+	peak    int64
+}
+
+// NewPeakGaugeVec creates new PeakGaugeVec
+func NewPeakGaugeVec(opts prometheus.GaugeOpts) *PeakGaugeVec {
+	desc := prometheus.NewDesc(
+		prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		opts.Help,
+		[]string{"handler_name"},
+		opts.ConstLabels,
+	)
+
+	return &PeakGaugeVec{desc: desc, peaks: map[string]*PeakGauge{}}
+}
+
+// WithHandler returns the gauge for a given handler name
+func (v *PeakGaugeVec) WithHandler(handlerName string) *PeakGauge {
+	v.lock.RLock()
+	gauge, ok := v.peaks[handlerName]
+	v.lock.RUnlock()
+	if ok {
+		return gauge
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if gauge, ok = v.peaks[handlerName]; !ok {
+		gauge = &PeakGauge{}
+		v.peaks[handlerName] = gauge
+	}
+	return gauge
+}
+
+// Inc marks the start of a request and updates the peak if needed
+func (g *PeakGauge) Inc() {
+	current := atomic.AddInt64(&g.current, 1)
+	for {
+		peak := atomic.LoadInt64(&g.peak)
+		if current <= peak || atomic.CompareAndSwapInt64(&g.peak, peak, current) {
+			return
+		}
+	}
+}
+
+// Dec marks the end of a request
+func (g *PeakGauge) Dec() {
+	atomic.AddInt64(&g.current, -1)
+}
+
+// Describe implements prometheus Collector interface.
+func (v *PeakGaugeVec) Describe(in chan<- *prometheus.Desc) {
+	in <- v.desc
+}
+
+// Collect implements prometheus Collector interface.
+func (v *PeakGaugeVec) Collect(in chan<- prometheus.Metric) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	for handlerName, gauge := range v.peaks {
+		peak := atomic.SwapInt64(&gauge.peak, atomic.LoadInt64(&gauge.current))
+		in <- prometheus.MustNewConstMetric(v.desc, prometheus.GaugeValue, float64(peak), handlerName)
+	}
+}
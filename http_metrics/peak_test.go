@@ -0,0 +1,98 @@
+package http_metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/harnash/go-middlewares"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInFlightMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	assert.NoError(t, err, "could not create metrics")
+	concurrency := metrics.(ConcurrencyMetrics)
+
+	started := sync.WaitGroup{}
+	release := make(chan struct{})
+	handler := Measured(WithName("slow"), WithMetrics(metrics))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started.Done()
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	finished := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		started.Add(1)
+		finished.Add(1)
+		go func() {
+			defer finished.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}()
+	}
+	started.Wait()
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(concurrency.GetInFlight().WithLabelValues("slow")), "invalid number of requests in flight")
+	assert.Equal(t, 3.0, testutil.ToFloat64(concurrency.GetMaxInFlight()), "invalid peak of requests in flight")
+
+	close(release)
+	finished.Wait()
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(concurrency.GetInFlight().WithLabelValues("slow")), "requests in flight not decremented")
+	assert.Equal(t, 3.0, testutil.ToFloat64(concurrency.GetMaxInFlight()), "peak should be reported until the next scrape")
+	assert.Equal(t, 0.0, testutil.ToFloat64(concurrency.GetMaxInFlight()), "peak not reset after scrape")
+}
+
+func TestQueueWaitMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	assert.NoError(t, err, "could not create metrics")
+
+	limiter := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.RecordQueueWait(r.Context(), 30*time.Millisecond)
+			h.ServeHTTP(w, r)
+		})
+	}
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	Measured(WithName("limited"), WithMetrics(metrics))(limiter(okHandler)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	Measured(WithName("unlimited"), WithMetrics(metrics))(okHandler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	families, err := registry.Gather()
+	if assert.NoError(t, err, "could not gather metrics") {
+		counts := map[string]uint64{}
+		for _, family := range families {
+			if family.GetName() == "http_handler_queue_wait_seconds" {
+				for _, metric := range family.GetMetric() {
+					counts[metric.GetLabel()[0].GetValue()] = metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+		assert.Equal(t, map[string]uint64{"limited": 1, "unlimited": 0}, counts, "queue wait should be observed only for limited handlers")
+	}
+}
+
+func TestConcurrencyMetricsOptional(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	assert.NoError(t, err, "could not create metrics")
+	concurrency := metrics.(ConcurrencyMetrics)
+
+	handler := Measured(WithName("custom"), WithMetrics(customMetrics{metrics}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middlewares.RecordQueueWait(r.Context(), 30*time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.GetTotalRequests()), "request not counted")
+	assert.Zero(t, testutil.CollectAndCount(concurrency.GetInFlight()), "requests in flight should not be tracked")
+	assert.Zero(t, testutil.CollectAndCount(concurrency.GetMaxInFlight()), "peak should not be tracked")
+	assert.Zero(t, testutil.CollectAndCount(concurrency.GetQueueWait()), "queue wait should not be observed")
+}
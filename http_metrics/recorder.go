@@ -0,0 +1,117 @@
+package http_metrics
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// responseRecorder is a single http.ResponseWriter wrapper capturing everything needed by all the metrics
+type responseRecorder struct {
+	http.ResponseWriter
+	status        int
+	written       int64
+	headerWritten bool
+	headerTime    time.Time
+}
+
+// writeHeader records the status of the final (non-informational) response headers
+func (rec *responseRecorder) writeHeader(code int) {
+	if rec.headerWritten {
+		return
+	}
+	if code >= http.StatusOK || code == http.StatusSwitchingProtocols {
+		rec.headerWritten = true
+		rec.headerTime = time.Now()
+		rec.status = code
+	}
+}
+
+// WriteHeader implements net/http.ResponseWriter's WriteHeader()
+func (rec *responseRecorder) WriteHeader(code int) {
+	rec.writeHeader(code)
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements net/http.ResponseWriter's Write()
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.writeHeader(http.StatusOK)
+	n, err := rec.ResponseWriter.Write(b)
+	rec.written += int64(n)
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom so the underlying writer can still use optimizations like sendfile
+func (rec *responseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	rec.writeHeader(http.StatusOK)
+	var n int64
+	var err error
+	if rf, ok := rec.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(rec.ResponseWriter, src)
+	}
+	rec.written += n
+	return n, err
+}
+
+// Flush implements net/http.Flusher interface
+func (rec *responseRecorder) Flush() {
+	rec.writeHeader(http.StatusOK)
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements net/http.Hijacker interface
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rec.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the original http.ResponseWriter (used by net/http.ResponseController)
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// statusCode returns the recorded status (200 if the handler did not write anything)
+func (rec *responseRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// methodLabel returns the value of the "method" label, limiting it to the standard methods
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodHead, http.MethodPost, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace, http.MethodPatch, "NOTIFY":
+		return strings.ToLower(method)
+	default:
+		return "unknown"
+	}
+}
+
+// approximateRequestSize computes the size of the request the same way promhttp does
+func approximateRequestSize(r *http.Request) int64 {
+	var size int64
+	if r.URL != nil {
+		size += int64(len(r.URL.String()))
+	}
+
+	size += int64(len(r.Method) + len(r.Proto) + len(r.Host))
+	for name, values := range r.Header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+
+	if r.ContentLength != -1 {
+		size += r.ContentLength
+	}
+	return size
+}
@@ -0,0 +1,127 @@
+package http_metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OtherRoute is the "route" label value used for routes exceeding the cardinality limit
+const OtherRoute = "other"
+
+// RouteExtractor returns the value of the "route" label for a handled request
+type RouteExtractor func(r *http.Request) string
+
+// PatternRoute uses the pattern of the http.ServeMux route that matched the request (Go 1.22+)
+func PatternRoute(r *http.Request) string {
+	return r.Pattern
+}
+
+// WithRoute sets the function used to get the "route" label value of a request. By default the http.ServeMux
+// pattern is used and the handler name if the pattern is not available. Route is extracted once the request is
+// handled so routers that match routes inside the wrapped handler are supported too.
+func WithRoute(extractor RouteExtractor) Option {
+	return func(o *options) {
+		o.route = extractor
+	}
+}
+
+// WithRouteLabel adds the "route" label to all request metrics. At most maxRoutes (must be positive) distinct values
+// are tracked, unseen routes above the limit are collapsed into OtherRoute (see: RouteLimiter).
+func WithRouteLabel(maxRoutes int) MetricsOption {
+	return func(o *metricsOptions) {
+		o.routeLabel = true
+		o.maxRoutes = maxRoutes
+	}
+}
+
+// RouteLimiter protects metrics from unbounded cardinality of the "route" label
+type RouteLimiter struct {
+	max       int
+	lock      sync.RWMutex
+	seen      map[string]struct{}
+	collapsed prometheus.Counter
+}
+
+// NewRouteLimiter creates new RouteLimiter tracking at most max distinct routes. Collapsed routes are counted by the
+// "http_route_label_collapsed_total" metric.
+func NewRouteLimiter(max int, opts prometheus.CounterOpts) *RouteLimiter {
+	opts.Name = "http_route_label_collapsed_total"
+	opts.Help = "number of requests with route label collapsed into \"" + OtherRoute + "\" due to cardinality limit"
+
+	return &RouteLimiter{
+		max:       max,
+		seen:      map[string]struct{}{},
+		collapsed: prometheus.NewCounter(opts),
+	}
+}
+
+// Limit returns given route if it was seen before or the limit is not reached yet, OtherRoute otherwise
+func (l *RouteLimiter) Limit(route string) string {
+	l.lock.RLock()
+	_, ok := l.seen[route]
+	l.lock.RUnlock()
+	if ok {
+		return route
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, ok = l.seen[route]; ok {
+		return route
+	}
+	if len(l.seen) >= l.max {
+		l.collapsed.Inc()
+		return OtherRoute
+	}
+	l.seen[route] = struct{}{}
+	return route
+}
+
+// Describe implements prometheus Collector interface.
+func (l *RouteLimiter) Describe(in chan<- *prometheus.Desc) {
+	l.collapsed.Describe(in)
+}
+
+// Collect implements prometheus Collector interface.
+func (l *RouteLimiter) Collect(in chan<- prometheus.Metric) {
+	l.collapsed.Collect(in)
+}
+
+// requestLabels returns names of labels for request metrics including the "route" label if enabled
+func (o *metricsOptions) requestLabels(names ...string) []string {
+	if o.routeLabel {
+		return append(names, "route")
+	}
+	return names
+}
+
+// routeLimiter creates RouteLimiter if the "route" label is enabled
+func (o *metricsOptions) routeLimiter() *RouteLimiter {
+	if !o.routeLabel {
+		return nil
+	}
+
+	return NewRouteLimiter(o.maxRoutes, prometheus.CounterOpts{
+		Namespace:   o.namespace,
+		Subsystem:   o.subsystem,
+		ConstLabels: o.constLabels,
+	})
+}
+
+// routeLabel returns the "route" label value for a handled request
+func (i *instrumentation) routeLabel(r *http.Request) string {
+	var route string
+	if i.route != nil {
+		route = i.route(r)
+	} else {
+		route = PatternRoute(r)
+	}
+
+	if len(route) == 0 {
+		route = i.handlerName
+	}
+
+	return i.routes.Limit(route)
+}
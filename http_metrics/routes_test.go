@@ -0,0 +1,66 @@
+package http_metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteLabel(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry, WithRouteLabel(2))
+	assert.NoError(t, err, "could not create metrics")
+
+	measured := Measured(WithName("api"), WithMetrics(metrics))
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	router := http.NewServeMux()
+	router.Handle("GET /items/{id}", measured(okHandler))
+	router.Handle("GET /users/{id}", measured(okHandler))
+	router.Handle("GET /orders/{id}", measured(okHandler))
+
+	for _, path := range []string{"/items/1", "/items/2", "/users/1", "/orders/1", "/orders/2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	// handlers outside of the router fall back to the handler name
+	measured(okHandler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	// custom extractor
+	Measured(WithName("custom"), WithMetrics(metrics), WithRoute(func(r *http.Request) string { return "GET /items/{id}" }))(okHandler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	body := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, body, `http_requests_total{code="200",method="get",route="GET /items/{id}"} 3`, "route label not set")
+	assert.Contains(t, body, `http_requests_total{code="200",method="get",route="GET /users/{id}"} 1`, "route label not set")
+	assert.Contains(t, body, `http_requests_total{code="200",method="get",route="other"} 3`, "routes above the limit not collapsed")
+	assert.Contains(t, body, `http_handler_statuses_total{handler_name="api",method="get",route="GET /items/{id}",status_bucket="2xx"} 2`, "route label not set on status metric")
+	assert.Contains(t, body, `http_route_label_collapsed_total 3`, "collapsed routes not counted")
+}
+
+func TestRouteLabelMaxRoutes(t *testing.T) {
+	for _, maxRoutes := range []int{0, -1} {
+		registry := prometheus.NewRegistry()
+		_, err := NewMetrics(registry, WithRouteLabel(maxRoutes))
+		assert.Error(t, err, "max routes %d should not be accepted", maxRoutes)
+		families, err := registry.Gather()
+		assert.NoError(t, err, "could not gather metrics")
+		assert.Empty(t, families, "invalid metrics should not be registered")
+	}
+}
+
+func TestRouteMetricsOptional(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	assert.NoError(t, err, "could not create metrics")
+
+	router := http.NewServeMux()
+	router.Handle("GET /items/{id}", Measured(WithName("api"), WithMetrics(customMetrics{metrics}))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items/1", nil))
+
+	body := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, body, `http_requests_total{code="200",method="get"} 1`, "request without route label not counted")
+}
@@ -0,0 +1,130 @@
+package http_metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Apdex zones used as values of the "apdex_zone" label
+const (
+	ApdexSatisfied  = "satisfied"
+	ApdexTolerating = "tolerating"
+	ApdexFrustrated = "frustrated"
+)
+
+// SLO names used as values of the "slo" label
+const (
+	AvailabilitySLO = "availability"
+	LatencySLO      = "latency"
+)
+
+// WithApdex enables counting requests per Apdex zone in the "http_handler_apdex_requests_total" metric. Requests
+// handled within satisfied threshold are satisfied, within tolerating threshold are tolerating and all the slower ones
+// are frustrated. Server errors (5xx) are always frustrated. Apdex score can be then computed with:
+//
+//	(satisfied + tolerating / 2) / (satisfied + tolerating + frustrated)
+func WithApdex(satisfied, tolerating time.Duration) Option {
+	return func(o *options) {
+		o.apdex = &apdexThresholds{satisfied: satisfied, tolerating: tolerating}
+	}
+}
+
+// WithAvailabilitySLO enables tracking availability objective (eg. 0.999) of the handler. Every request is an event
+// in the "http_handler_slo_events_total" metric and requests that did not end with server error (5xx) are counted as
+// good events in the "http_handler_slo_good_events_total" metric.
+func WithAvailabilitySLO(objective float64) Option {
+	return func(o *options) {
+		o.slos = append(o.slos, slo{name: AvailabilitySLO, objective: objective})
+	}
+}
+
+// WithLatencySLO enables tracking latency objective of the handler: given fraction (eg. 0.99) of the requests should
+// be handled within threshold. Every request is an event and requests handled in time are good events.
+func WithLatencySLO(threshold time.Duration, objective float64) Option {
+	return func(o *options) {
+		o.slos = append(o.slos, slo{name: LatencySLO, objective: objective, threshold: threshold})
+	}
+}
+
+type apdexThresholds struct {
+	satisfied  time.Duration
+	tolerating time.Duration
+}
+
+// zone returns the Apdex zone of the handled request
+func (a *apdexThresholds) zone(status int, duration time.Duration) string {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return ApdexFrustrated
+	case duration <= a.satisfied:
+		return ApdexSatisfied
+	case duration <= a.tolerating:
+		return ApdexTolerating
+	default:
+		return ApdexFrustrated
+	}
+}
+
+type slo struct {
+	name      string
+	objective float64
+	threshold time.Duration
+}
+
+// good reports if the handled request is a good event of the objective
+func (s slo) good(status int, duration time.Duration) bool {
+	if s.name == LatencySLO {
+		return duration <= s.threshold
+	}
+
+	return status < http.StatusInternalServerError
+}
+
+// sloInstrumentation holds SLO metrics prepared for a single handler
+type sloInstrumentation struct {
+	slo
+	events prometheus.Counter
+	good   prometheus.Counter
+}
+
+// newApdexInstrumentation prepares counters of all Apdex zones so the score can be computed from the first request
+func newApdexInstrumentation(metrics ObjectiveMetrics, handlerName string) map[string]prometheus.Counter {
+	zones := map[string]prometheus.Counter{}
+	for _, zone := range []string{ApdexSatisfied, ApdexTolerating, ApdexFrustrated} {
+		zones[zone] = metrics.GetApdex().WithLabelValues(handlerName, zone)
+	}
+
+	return zones
+}
+
+// newSLOInstrumentation prepares event counters of all objectives and exposes the objectives
+func newSLOInstrumentation(metrics ObjectiveMetrics, handlerName string, slos []slo) []sloInstrumentation {
+	var instrumented []sloInstrumentation
+	for _, s := range slos {
+		labels := prometheus.Labels{"handler_name": handlerName, "slo": s.name}
+		metrics.GetSLOObjective().With(labels).Set(s.objective)
+		instrumented = append(instrumented, sloInstrumentation{
+			slo:    s,
+			events: metrics.GetSLOEvents().With(labels),
+			good:   metrics.GetSLOGoodEvents().With(labels),
+		})
+	}
+
+	return instrumented
+}
+
+// observeObjectives records Apdex zone and SLO events of a handled request
+func (i *instrumentation) observeObjectives(status int, duration time.Duration) {
+	if i.apdex != nil {
+		i.apdexZones[i.apdex.zone(status, duration)].Inc()
+	}
+
+	for _, s := range i.slos {
+		s.events.Inc()
+		if s.slo.good(status, duration) {
+			s.good.Inc()
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package http_metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApdexZones(t *testing.T) {
+	thresholds := apdexThresholds{satisfied: 100 * time.Millisecond, tolerating: 400 * time.Millisecond}
+
+	assert.Equal(t, ApdexSatisfied, thresholds.zone(http.StatusOK, 100*time.Millisecond), "invalid zone")
+	assert.Equal(t, ApdexTolerating, thresholds.zone(http.StatusNotFound, 101*time.Millisecond), "invalid zone")
+	assert.Equal(t, ApdexFrustrated, thresholds.zone(http.StatusOK, 401*time.Millisecond), "invalid zone")
+	assert.Equal(t, ApdexFrustrated, thresholds.zone(http.StatusBadGateway, time.Millisecond), "server errors should be frustrated")
+}
+
+func TestSLOGoodEvents(t *testing.T) {
+	availability := slo{name: AvailabilitySLO, objective: 0.999}
+	latency := slo{name: LatencySLO, objective: 0.99, threshold: 250 * time.Millisecond}
+
+	assert.True(t, availability.good(http.StatusNotFound, time.Second), "client errors should not affect availability")
+	assert.False(t, availability.good(http.StatusServiceUnavailable, time.Millisecond), "server errors should affect availability")
+	assert.True(t, latency.good(http.StatusOK, 250*time.Millisecond), "request handled in time")
+	assert.False(t, latency.good(http.StatusOK, 251*time.Millisecond), "request not handled in time")
+}
+
+func TestMeasuredObjectives(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	assert.NoError(t, err, "could not create metrics")
+
+	status := http.StatusOK
+	handler := Measured(WithName("checkout"), WithMetrics(metrics), WithApdex(time.Hour, 2*time.Hour),
+		WithAvailabilitySLO(0.999), WithLatencySLO(time.Hour, 0.99))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	status = http.StatusInternalServerError
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	body := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, body, `http_handler_apdex_requests_total{apdex_zone="satisfied",handler_name="checkout"} 1`, "satisfied requests not counted")
+	assert.Contains(t, body, `http_handler_apdex_requests_total{apdex_zone="tolerating",handler_name="checkout"} 0`, "zones should be initialized")
+	assert.Contains(t, body, `http_handler_apdex_requests_total{apdex_zone="frustrated",handler_name="checkout"} 1`, "frustrated requests not counted")
+	assert.Contains(t, body, `http_handler_slo_events_total{handler_name="checkout",slo="availability"} 2`, "availability events not counted")
+	assert.Contains(t, body, `http_handler_slo_good_events_total{handler_name="checkout",slo="availability"} 1`, "good availability events not counted")
+	assert.Contains(t, body, `http_handler_slo_good_events_total{handler_name="checkout",slo="latency"} 2`, "good latency events not counted")
+	assert.Contains(t, body, `http_handler_slo_objective_ratio{handler_name="checkout",slo="availability"} 0.999`, "objective not exposed")
+	assert.Contains(t, body, `http_handler_slo_objective_ratio{handler_name="checkout",slo="latency"} 0.99`, "objective not exposed")
+}
+
+func TestObjectiveMetricsRequired(t *testing.T) {
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	assert.NoError(t, err, "could not create metrics")
+
+	_, err = MeasuredE(WithName("checkout"), WithMetrics(customMetrics{metrics}), WithApdex(time.Second, time.Minute))
+	assert.Error(t, err, "apdex requires metrics implementing ObjectiveMetrics")
+	_, err = MeasuredE(WithName("checkout"), WithMetrics(customMetrics{metrics}), WithAvailabilitySLO(0.999))
+	assert.Error(t, err, "SLOs require metrics implementing ObjectiveMetrics")
+
+	measured, err := MeasuredE(WithName("checkout"), WithMetrics(customMetrics{metrics}))
+	if assert.NoError(t, err, "metrics without objectives should be accepted") {
+		rec := httptest.NewRecorder()
+		measured(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusOK, rec.Code, "invalid status")
+	}
+}
@@ -0,0 +1,64 @@
+package http_metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// StatusClientClosedRequest is the status reported for requests cancelled by the client before the response was
+// sent (nginx convention)
+const StatusClientClosedRequest = 499
+
+// ClientClosedStatus is the status class of requests cancelled by the client
+const ClientClosedStatus = "client_closed"
+
+// StatusLabeler returns the value of status labels ("code" and "status_bucket") for a given status
+type StatusLabeler func(status int) string
+
+// ExactStatus labels responses with the exact status code (default for the "code" label)
+func ExactStatus(status int) string {
+	return strconv.Itoa(status)
+}
+
+// StatusClass labels responses with the status class: 1xx, 2xx, 3xx, 4xx, 5xx or ClientClosedStatus for requests
+// cancelled by the client (default for the "status_bucket" label)
+func StatusClass(status int) string {
+	switch {
+	case status == StatusClientClosedRequest:
+		return ClientClosedStatus
+	case status >= 100 && status <= 199:
+		return "1xx"
+	case status >= 200 && status <= 299:
+		return "2xx"
+	case status >= 300 && status <= 399:
+		return "3xx"
+	case status >= 400 && status <= 499:
+		return "4xx"
+	case status >= 500 && status <= 599:
+		return "5xx"
+	default:
+		return "unknown"
+	}
+}
+
+// WithStatusLabels sets the function used to label statuses in all the metrics. By default the "code" label holds
+// the exact status (ExactStatus) and the "status_bucket" label holds the status class (StatusClass). Custom labeler
+// is used for both labels so eg. StatusClass can be used to lower the cardinality of the "code" label or a custom
+// mapper to group some statuses together.
+func WithStatusLabels(labeler StatusLabeler) Option {
+	return func(o *options) {
+		o.statusLabel = labeler
+	}
+}
+
+// responseStatus returns the status of a handled request or StatusClientClosedRequest if the client cancelled it
+// before the response headers were written
+func responseStatus(r *http.Request, rec *responseRecorder) int {
+	if !rec.headerWritten && errors.Is(r.Context().Err(), context.Canceled) {
+		return StatusClientClosedRequest
+	}
+
+	return rec.statusCode()
+}
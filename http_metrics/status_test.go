@@ -0,0 +1,72 @@
+package http_metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "1xx", StatusClass(http.StatusSwitchingProtocols), "informational statuses should have own class")
+	assert.Equal(t, "2xx", StatusClass(http.StatusNoContent), "invalid status class")
+	assert.Equal(t, "4xx", StatusClass(http.StatusNotFound), "invalid status class")
+	assert.Equal(t, ClientClosedStatus, StatusClass(StatusClientClosedRequest), "client cancellations should have own class")
+	assert.Equal(t, "5xx", StatusClass(http.StatusBadGateway), "invalid status class")
+	assert.Equal(t, "unknown", StatusClass(42), "invalid status class")
+}
+
+func TestStatusLabels(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	assert.NoError(t, err, "could not create metrics")
+
+	handler := func(status int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) })
+	}
+	Measured(WithName("class"), WithMetrics(metrics), WithStatusLabels(StatusClass))(handler(http.StatusCreated)).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	notFound := func(status int) string {
+		if status == http.StatusNotFound || status == http.StatusGone {
+			return "missing"
+		}
+		return StatusClass(status)
+	}
+	Measured(WithName("custom"), WithMetrics(metrics), WithStatusLabels(notFound))(handler(http.StatusGone)).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := httptest.NewRequest("POST", "/", nil).WithContext(ctx)
+	Measured(WithName("cancelled"), WithMetrics(metrics))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+	})).ServeHTTP(httptest.NewRecorder(), cancelled)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	disconnected := httptest.NewRequest("PUT", "/", nil).WithContext(ctx)
+	Measured(WithName("disconnected"), WithMetrics(metrics))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		cancel()
+	})).ServeHTTP(httptest.NewRecorder(), disconnected)
+
+	Measured(WithName("garbage"), WithMetrics(metrics))(handler(http.StatusOK)).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("Get", "/", nil))
+
+	body := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, body, `http_requests_total{code="2xx",method="get"} 1`, "status class not used for the code label")
+	assert.Contains(t, body, `http_handler_statuses_total{handler_name="class",method="get",status_bucket="2xx"} 1`, "status class not used for the status bucket label")
+	assert.Contains(t, body, `http_requests_total{code="missing",method="delete"} 1`, "custom labeler not used for the code label")
+	assert.Contains(t, body, `http_handler_statuses_total{handler_name="custom",method="delete",status_bucket="missing"} 1`, "custom labeler not used for the status bucket label")
+	assert.Contains(t, body, `http_requests_total{code="499",method="post"} 1`, "cancelled request not detected")
+	assert.Contains(t, body, `http_handler_statuses_total{handler_name="cancelled",method="post",status_bucket="client_closed"} 1`, "cancelled request not detected")
+	assert.Contains(t, body, `http_requests_total{code="500",method="put"} 1`, "written status should be kept")
+	assert.Contains(t, body, `http_handler_statuses_total{handler_name="disconnected",method="put",status_bucket="5xx"} 1`,
+		"written status should be kept")
+	assert.Contains(t, body, `http_handler_statuses_total{handler_name="garbage",method="unknown",status_bucket="2xx"} 1`,
+		"method label should be bounded")
+}
@@ -0,0 +1,339 @@
+package http_metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ClientMetrics defines interface for custom metric collector/container used by Transport
+type ClientMetrics interface {
+	prometheus.Collector
+	GetRequests() *prometheus.CounterVec
+	GetDuration() *prometheus.HistogramVec
+	GetInFlight() *prometheus.GaugeVec
+	GetDNSDuration() *prometheus.HistogramVec
+	GetConnectDuration() *prometheus.HistogramVec
+	GetTLSDuration() *prometheus.HistogramVec
+	GetTimeToFirstByte() *prometheus.HistogramVec
+	GetErrors() *prometheus.CounterVec
+}
+
+// defaultClientMetrics holds all the metrics regarding outgoing HTTP requests
+type defaultClientMetrics struct {
+	requests        *prometheus.CounterVec
+	duration        *prometheus.HistogramVec
+	inFlight        *prometheus.GaugeVec
+	dnsDuration     *prometheus.HistogramVec
+	connectDuration *prometheus.HistogramVec
+	tlsDuration     *prometheus.HistogramVec
+	timeToFirstByte *prometheus.HistogramVec
+	errors          *prometheus.CounterVec
+}
+
+var basicClientMetrics = newDefaultClientMetrics(&metricsOptions{})
+
+// GetRequests return metric that counts outgoing requests (with code "error" for failed requests)
+func (s defaultClientMetrics) GetRequests() *prometheus.CounterVec {
+	return s.requests
+}
+
+// GetDuration return metric that measures time until the response headers are received
+func (s defaultClientMetrics) GetDuration() *prometheus.HistogramVec {
+	return s.duration
+}
+
+// GetInFlight return metric that tracks number of outgoing requests waiting for the response
+func (s defaultClientMetrics) GetInFlight() *prometheus.GaugeVec {
+	return s.inFlight
+}
+
+// GetDNSDuration return metric that measures DNS lookups
+func (s defaultClientMetrics) GetDNSDuration() *prometheus.HistogramVec {
+	return s.dnsDuration
+}
+
+// GetConnectDuration return metric that measures establishing new connections
+func (s defaultClientMetrics) GetConnectDuration() *prometheus.HistogramVec {
+	return s.connectDuration
+}
+
+// GetTLSDuration return metric that measures TLS handshakes
+func (s defaultClientMetrics) GetTLSDuration() *prometheus.HistogramVec {
+	return s.tlsDuration
+}
+
+// GetTimeToFirstByte return metric that measures time until the first byte of the response is received
+func (s defaultClientMetrics) GetTimeToFirstByte() *prometheus.HistogramVec {
+	return s.timeToFirstByte
+}
+
+// GetErrors return metric that counts failed requests per error type
+func (s defaultClientMetrics) GetErrors() *prometheus.CounterVec {
+	return s.errors
+}
+
+// newDefaultClientMetrics creates new client metrics
+func newDefaultClientMetrics(cfg *metricsOptions) ClientMetrics {
+	histogram := func(name, help string, labels ...string) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:                       cfg.namespace,
+			Subsystem:                       cfg.subsystem,
+			ConstLabels:                     cfg.constLabels,
+			Name:                            name,
+			Help:                            help,
+			Buckets:                         cfg.buckets[DurationHistogram],
+			NativeHistogramBucketFactor:     cfg.nativeBucketFactor,
+			NativeHistogramMaxBucketNumber:  cfg.nativeMaxBuckets,
+			NativeHistogramMinResetDuration: cfg.nativeMinResetDuration,
+		}, labels)
+	}
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "http_client_requests_total",
+		Help:        "number of outgoing requests",
+	}, []string{"upstream", "code", "method"})
+
+	inFlight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "http_client_requests_in_flight",
+		Help:        "number of outgoing requests waiting for the response",
+	}, []string{"upstream"})
+
+	errorsTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "http_client_errors_total",
+		Help:        "number of failed outgoing requests per error type",
+	}, []string{"upstream", "error_type"})
+
+	return defaultClientMetrics{
+		requests:        requests,
+		duration:        histogram("http_client_request_duration_seconds", "time until the response headers were received in seconds", "upstream", "code", "method"),
+		inFlight:        inFlight,
+		dnsDuration:     histogram("http_client_dns_duration_seconds", "duration of DNS lookups in seconds", "upstream"),
+		connectDuration: histogram("http_client_connect_duration_seconds", "duration of establishing connections in seconds", "upstream"),
+		tlsDuration:     histogram("http_client_tls_duration_seconds", "duration of TLS handshakes in seconds", "upstream"),
+		timeToFirstByte: histogram("http_client_time_to_first_byte_seconds", "time until the first response byte was received in seconds", "upstream"),
+		errors:          errorsTotal,
+	}
+}
+
+// Describe implements prometheus Collector interface.
+func (s defaultClientMetrics) Describe(in chan<- *prometheus.Desc) {
+	s.requests.Describe(in)
+	s.duration.Describe(in)
+	s.inFlight.Describe(in)
+	s.dnsDuration.Describe(in)
+	s.connectDuration.Describe(in)
+	s.tlsDuration.Describe(in)
+	s.timeToFirstByte.Describe(in)
+	s.errors.Describe(in)
+}
+
+// Collect implements prometheus Collector interface.
+func (s defaultClientMetrics) Collect(in chan<- prometheus.Metric) {
+	s.requests.Collect(in)
+	s.duration.Collect(in)
+	s.inFlight.Collect(in)
+	s.dnsDuration.Collect(in)
+	s.connectDuration.Collect(in)
+	s.tlsDuration.Collect(in)
+	s.timeToFirstByte.Collect(in)
+	s.errors.Collect(in)
+}
+
+// NewClientMetrics creates new ClientMetrics container that can be passed to NewTransport using WithClientMetrics
+// option. All histograms use buckets configured for DurationHistogram. If registerer is not nil the metrics are
+// registered in it.
+func NewClientMetrics(registerer prometheus.Registerer, options ...MetricsOption) (ClientMetrics, error) {
+	cfg := &metricsOptions{
+		buckets: map[Histogram][]float64{DurationHistogram: DefaultDurationBuckets},
+	}
+
+	for _, o := range options {
+		o(cfg)
+	}
+
+	metrics := newDefaultClientMetrics(cfg)
+	if registerer != nil {
+		if err := registerer.Register(metrics); err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
+
+// RegisterDefaultClientMetrics will register default client metrics instance in Prometheus. This is only needed if
+// any transports are instrumented with default metrics (not overridden by WithClientMetrics() option)
+func RegisterDefaultClientMetrics(registerer prometheus.Registerer) error {
+	return registerer.Register(basicClientMetrics)
+}
+
+// UnregisterDefaultClientMetrics is a companion function to RegisterDefaultClientMetrics and must be called if
+// RegisterDefaultClientMetrics is used to cleanup the metrics in Prometheus
+func UnregisterDefaultClientMetrics(registerer prometheus.Registerer) {
+	registerer.Unregister(basicClientMetrics)
+}
+
+type transportOptions struct {
+	metrics  ClientMetrics
+	upstream string
+}
+
+// TransportOption represents a Transport option.
+type TransportOption func(*transportOptions)
+
+// WithClientMetrics sets custom metric collector/container for client metrics
+func WithClientMetrics(metrics ClientMetrics) TransportOption {
+	return func(o *transportOptions) {
+		o.metrics = metrics
+	}
+}
+
+// OtherUpstream is the value of the "upstream" label used by transports without WithUpstream option.
+const OtherUpstream = "other"
+
+// WithUpstream sets the value of the "upstream" label. The host of the request URL is never used as the label value
+// because it may come from redirects or user provided URLs, so transports without this option report all requests
+// with OtherUpstream.
+func WithUpstream(name string) TransportOption {
+	return func(o *transportOptions) {
+		o.upstream = name
+	}
+}
+
+// Transport is an http.RoundTripper that measures outgoing requests
+type Transport struct {
+	base    http.RoundTripper
+	options *transportOptions
+}
+
+// NewTransport will wrap given http.RoundTripper (http.DefaultTransport if nil) with a measuring Transport
+func NewTransport(base http.RoundTripper, options ...TransportOption) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	cfg := &transportOptions{metrics: basicClientMetrics}
+	for _, o := range options {
+		o(cfg)
+	}
+
+	return &Transport{base: base, options: cfg}
+}
+
+// RoundTrip implements net/http.RoundTripper interface
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	metrics := t.options.metrics
+	upstream := t.options.upstream
+	if len(upstream) == 0 {
+		upstream = OtherUpstream
+	}
+
+	inFlight := metrics.GetInFlight().WithLabelValues(upstream)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	// trace callbacks might be called from the dialing goroutines (even concurrently for multiple addresses)
+	var lock sync.Mutex
+	var dnsStart, connectStart, tlsStart time.Time
+	since := func(t *time.Time) float64 {
+		lock.Lock()
+		defer lock.Unlock()
+		return time.Since(*t).Seconds()
+	}
+	mark := func(t *time.Time) {
+		lock.Lock()
+		defer lock.Unlock()
+		*t = time.Now()
+	}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { mark(&dnsStart) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err == nil {
+				metrics.GetDNSDuration().WithLabelValues(upstream).Observe(since(&dnsStart))
+			}
+		},
+		ConnectStart: func(string, string) { mark(&connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				metrics.GetConnectDuration().WithLabelValues(upstream).Observe(since(&connectStart))
+			}
+		},
+		TLSHandshakeStart: func() { mark(&tlsStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				metrics.GetTLSDuration().WithLabelValues(upstream).Observe(since(&tlsStart))
+			}
+		},
+		GotFirstResponseByte: func() {
+			metrics.GetTimeToFirstByte().WithLabelValues(upstream).Observe(time.Since(start).Seconds())
+		},
+	}
+
+	r = r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
+	resp, err := t.base.RoundTrip(r)
+	duration := time.Since(start).Seconds()
+	method := methodLabel(r.Method)
+
+	if err != nil {
+		metrics.GetRequests().WithLabelValues(upstream, "error", method).Inc()
+		metrics.GetDuration().WithLabelValues(upstream, "error", method).Observe(duration)
+		metrics.GetErrors().WithLabelValues(upstream, errorType(err)).Inc()
+		return resp, err
+	}
+
+	code := ExactStatus(resp.StatusCode)
+	metrics.GetRequests().WithLabelValues(upstream, code, method).Inc()
+	metrics.GetDuration().WithLabelValues(upstream, code, method).Observe(duration)
+
+	return resp, nil
+}
+
+// errorType classifies errors returned by the transport
+func errorType(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection_reset"
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &authorityErr), errors.As(err, &hostnameErr):
+		return "tls"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "other"
+	}
+}
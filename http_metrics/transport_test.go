@@ -0,0 +1,56 @@
+package http_metrics
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransportMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewClientMetrics(registry, WithNamespace("client"))
+	assert.NoError(t, err, "could not create client metrics")
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewTransport(srv.Client().Transport, WithClientMetrics(metrics), WithUpstream("payments"))}
+	resp, err := client.Post(srv.URL, "text/plain", nil)
+	if assert.NoError(t, err, "error making HTTP request") {
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "invalid HTTP status code")
+	}
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.GetRequests().WithLabelValues("payments", "201", "post")), "request not counted")
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.GetInFlight().WithLabelValues("payments")), "in flight requests not decremented")
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.GetDuration()), "duration not observed")
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.GetConnectDuration()), "connect duration not observed")
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.GetTLSDuration()), "TLS handshake duration not observed")
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.GetTimeToFirstByte()), "time to first byte not observed")
+}
+
+func TestTransportErrors(t *testing.T) {
+	metrics, err := NewClientMetrics(nil)
+	assert.NoError(t, err, "could not create client metrics")
+
+	// grab a free port and close the listener so the connection is refused
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if assert.NoError(t, err, "could not listen on a free port") {
+		addr := listener.Addr().String()
+		_ = listener.Close()
+
+		client := &http.Client{Transport: NewTransport(nil, WithClientMetrics(metrics))}
+		_, err = client.Get("http://" + addr)
+		assert.Error(t, err, "request should fail")
+
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.GetErrors().WithLabelValues(OtherUpstream, "connection_refused")), "error type not counted")
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.GetRequests().WithLabelValues(OtherUpstream, "error", "get")), "failed request not counted")
+	}
+}
@@ -0,0 +1,149 @@
+package limits
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ErrBodyTooSlow is returned when reading the request body if the client sends it slower than the minimum read rate
+var ErrBodyTooSlow = errors.New("limits: request body read rate too low")
+
+// rejection describes the violated limit
+type rejection struct {
+	reason string
+	status int
+	limit  int64
+}
+
+// bodyReader watches the request body for violations of the maximum size (enforced by http.MaxBytesReader) and the
+// minimum read rate. Read rate is enforced with connection read deadlines if they are supported, so reads blocked by
+// a trickling client are interrupted.
+type bodyReader struct {
+	io.ReadCloser
+	controller *http.ResponseController
+	maxSize    int64
+	rate       int64
+	grace      time.Duration
+	start      time.Time
+	read       int64
+	deadlines  bool
+	violation  *rejection
+	// err is the error returned by the body, after it net/http may read the connection in the background so the
+	// deadline must not be set anymore
+	err error
+}
+
+// Read implements io.Reader interface
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.violation != nil && b.violation.reason == ReasonReadRate {
+		return 0, ErrBodyTooSlow
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.rate > 0 && b.deadlines {
+		if err := b.controller.SetReadDeadline(b.deadline()); err != nil {
+			b.deadlines = false
+		}
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil {
+		b.err = err
+		b.finish()
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		b.violation = &rejection{reason: ReasonBodySize, status: http.StatusRequestEntityTooLarge, limit: b.maxSize}
+	case b.rate > 0 && errors.Is(err, os.ErrDeadlineExceeded),
+		b.rate > 0 && err == nil && b.tooSlow(time.Now()):
+		b.violation = &rejection{reason: ReasonReadRate, status: http.StatusRequestTimeout, limit: b.rate}
+		return n, ErrBodyTooSlow
+	}
+
+	return n, err
+}
+
+// deadline returns the time the next byte of the body must arrive by to keep the minimum read rate
+func (b *bodyReader) deadline() time.Time {
+	return b.start.Add(b.grace + time.Duration(float64(b.read+1)/float64(b.rate)*float64(time.Second)))
+}
+
+// tooSlow reports if the body was read slower than the minimum read rate after the grace period
+func (b *bodyReader) tooSlow(now time.Time) bool {
+	elapsed := now.Sub(b.start) - b.grace
+	return elapsed > 0 && float64(b.read) < elapsed.Seconds()*float64(b.rate)
+}
+
+// finish clears the read deadline so it does not affect the background read of the connection and the following
+// requests. The deadline is not touched again afterwards.
+func (b *bodyReader) finish() {
+	if b.rate > 0 && b.deadlines {
+		b.deadlines = false
+		_ = b.controller.SetReadDeadline(time.Time{})
+	}
+}
+
+// guardWriter replaces the response of the handler with the rejection response if the request body violated the
+// limits before the handler committed the response
+type guardWriter struct {
+	http.ResponseWriter
+	body    *bodyReader
+	reject  func(w http.ResponseWriter, violation *rejection)
+	written bool
+	discard bool
+}
+
+// WriteHeader implements net/http.ResponseWriter's WriteHeader()
+func (g *guardWriter) WriteHeader(code int) {
+	if g.written {
+		return
+	}
+	if g.body.violation != nil {
+		g.written = true
+		g.discard = true
+		g.reject(g.ResponseWriter, g.body.violation)
+		return
+	}
+	// informational responses can be followed by other headers
+	if code >= 200 || code == http.StatusSwitchingProtocols {
+		g.written = true
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements net/http.ResponseWriter's Write()
+func (g *guardWriter) Write(b []byte) (int, error) {
+	if !g.written {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.discard {
+		return len(b), nil
+	}
+
+	return g.ResponseWriter.Write(b)
+}
+
+// Flush implements net/http.Flusher interface
+func (g *guardWriter) Flush() {
+	if !g.written {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.discard {
+		return
+	}
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the original http.ResponseWriter (used by net/http.ResponseController)
+func (g *guardWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
@@ -0,0 +1,100 @@
+package limits
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyReaderRate(t *testing.T) {
+	start := time.Now()
+	b := &bodyReader{rate: 100, grace: time.Second, start: start}
+
+	assert.Equal(t, start.Add(time.Second+10*time.Millisecond), b.deadline(), "invalid deadline of the first byte")
+	assert.False(t, b.tooSlow(start.Add(time.Second)), "read rate should not be checked in the grace period")
+	assert.True(t, b.tooSlow(start.Add(2*time.Second)), "slow read should be detected")
+
+	b.read = 100
+	assert.Equal(t, start.Add(2*time.Second+10*time.Millisecond), b.deadline(), "invalid deadline of the next byte")
+	assert.False(t, b.tooSlow(start.Add(2*time.Second)), "read at the minimum rate should be allowed")
+}
+
+func TestBodyReaderRateWithoutDeadlines(t *testing.T) {
+	rec := httptest.NewRecorder()
+	b := &bodyReader{
+		ReadCloser: io.NopCloser(strings.NewReader("payload")),
+		controller: http.NewResponseController(rec),
+		rate:       1,
+		start:      time.Now().Add(-time.Minute),
+		deadlines:  true,
+	}
+
+	_, err := b.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrBodyTooSlow, "slow read should be detected after the read")
+	assert.False(t, b.deadlines, "deadlines should be disabled if not supported")
+	_, err = b.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrBodyTooSlow, "following reads should fail")
+	if assert.NotNil(t, b.violation, "violation not recorded") {
+		assert.Equal(t, ReasonReadRate, b.violation.reason, "invalid reason")
+	}
+}
+
+// deadlineRecorder records the read deadlines set with net/http.ResponseController
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadlines []time.Time
+}
+
+func (d *deadlineRecorder) SetReadDeadline(deadline time.Time) error {
+	d.deadlines = append(d.deadlines, deadline)
+	return nil
+}
+
+func TestBodyReaderDeadlineAfterEOF(t *testing.T) {
+	rec := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+	b := &bodyReader{
+		ReadCloser: io.NopCloser(strings.NewReader("payload")),
+		controller: http.NewResponseController(rec),
+		rate:       100,
+		grace:      time.Second,
+		start:      time.Now(),
+		deadlines:  true,
+	}
+
+	body, err := io.ReadAll(b)
+	assert.NoError(t, err, "could not read body")
+	assert.Equal(t, "payload", string(body), "invalid body")
+	if assert.NotEmpty(t, rec.deadlines, "deadline not set") {
+		assert.True(t, rec.deadlines[len(rec.deadlines)-1].IsZero(), "deadline should be cleared at EOF")
+	}
+
+	set := len(rec.deadlines)
+	n, err := b.Read(make([]byte, 1))
+	assert.Zero(t, n, "nothing should be read after EOF")
+	assert.ErrorIs(t, err, io.EOF, "EOF should be returned again")
+	b.finish()
+	assert.Len(t, rec.deadlines, set, "deadline should not be touched after EOF")
+}
+
+func TestGuardWriterCommitted(t *testing.T) {
+	rec := httptest.NewRecorder()
+	body := &bodyReader{}
+	guard := &guardWriter{ResponseWriter: rec, body: body, reject: func(w http.ResponseWriter, violation *rejection) {
+		assert.Fail(t, "committed response should not be replaced")
+	}}
+
+	_, _ = guard.Write([]byte("partial"))
+	guard.Flush()
+	body.violation = &rejection{reason: ReasonBodySize, status: http.StatusRequestEntityTooLarge}
+	guard.WriteHeader(http.StatusBadRequest)
+	_, _ = guard.Write([]byte(" response"))
+
+	assert.Equal(t, http.StatusOK, rec.Code, "invalid status")
+	assert.True(t, rec.Flushed, "flush should be passed through")
+	assert.Equal(t, "partial response", rec.Body.String(), "invalid body")
+}
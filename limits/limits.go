@@ -0,0 +1,267 @@
+package limits
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/harnash/go-middlewares"
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons of rejected requests used in logs and metrics
+const (
+	ReasonURLLength   = "url_length"
+	ReasonHeaderCount = "header_count"
+	ReasonHeaderSize  = "header_size"
+	ReasonBodySize    = "body_size"
+	ReasonReadRate    = "read_rate"
+)
+
+type options struct {
+	metrics     Metrics
+	name        string
+	maxBody     int64
+	routeBodies map[string]int64
+	minRate     int64
+	rateGrace   time.Duration
+	maxHeaders  int
+	maxHeader   int
+	maxURL      int
+}
+
+// Option represents a request limits option.
+type Option func(*options)
+
+// WithMetrics sets custom metric collector/container for request limits metrics
+func WithMetrics(metrics Metrics) Option {
+	return func(o *options) {
+		o.metrics = metrics
+	}
+}
+
+// WithName sets the name of the handler used in metrics ("default" by default)
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithMaxBodySize limits the size of the request body in bytes. Requests with larger Content-Length are rejected
+// before reaching the handler, other requests fail when reading the body past the limit.
+func WithMaxBodySize(size int64) Option {
+	return func(o *options) {
+		o.maxBody = size
+	}
+}
+
+// WithRouteBodySizes overrides the maximum body size for the request paths (or the http.ServeMux patterns) found in
+// the map. Zero size disables the limit for the route.
+func WithRouteBodySizes(sizes map[string]int64) Option {
+	return func(o *options) {
+		o.routeBodies = sizes
+	}
+}
+
+// WithMinReadRate requires the client to send the request body at the rate of at least bytesPerSecond after the
+// grace period. Reads blocked by a slower client are interrupted with ErrBodyTooSlow.
+func WithMinReadRate(bytesPerSecond int64, grace time.Duration) Option {
+	return func(o *options) {
+		o.minRate = bytesPerSecond
+		o.rateGrace = grace
+	}
+}
+
+// WithMaxHeaders limits the number of header values and the total size of header names and values in bytes
+func WithMaxHeaders(count int, size int) Option {
+	return func(o *options) {
+		o.maxHeaders = count
+		o.maxHeader = size
+	}
+}
+
+// WithMaxURLLength limits the length of the request URI
+func WithMaxURLLength(length int) Option {
+	return func(o *options) {
+		o.maxURL = length
+	}
+}
+
+// Metrics defines interface for custom metric collector/container
+type Metrics interface {
+	prometheus.Collector
+	GetRejected() *prometheus.CounterVec
+}
+
+// defaultMetrics holds all the metrics of rejected requests
+type defaultMetrics struct {
+	rejected *prometheus.CounterVec
+}
+
+var basicMetrics = newDefaultMetrics()
+
+// GetRejected return metric that counts rejected requests per reason
+func (s defaultMetrics) GetRejected() *prometheus.CounterVec {
+	return s.rejected
+}
+
+// newDefaultMetrics creates new request limits metrics
+func newDefaultMetrics() Metrics {
+	rejected := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_limits_rejected_total",
+		Help: "number of requests rejected for exceeding the limits per reason",
+	}, []string{"handler_name", "reason"})
+
+	return defaultMetrics{rejected: rejected}
+}
+
+// Describe implements prometheus Collector interface.
+func (s defaultMetrics) Describe(in chan<- *prometheus.Desc) {
+	s.rejected.Describe(in)
+}
+
+// Collect implements prometheus Collector interface.
+func (s defaultMetrics) Collect(in chan<- prometheus.Metric) {
+	s.rejected.Collect(in)
+}
+
+// RegisterDefaultMetrics will register default request limits metrics instance in Prometheus. This is only needed if
+// any handlers are protected with default metrics (not overridden by WithMetrics() option)
+func RegisterDefaultMetrics(registerer prometheus.Registerer) error {
+	return registerer.Register(basicMetrics)
+}
+
+// UnregisterDefaultMetrics is a companion function to RegisterDefaultMetrics and must be called if RegisterDefaultMetrics
+// is used to cleanup the metrics in Prometheus
+func UnregisterDefaultMetrics(registerer prometheus.Registerer) {
+	registerer.Unregister(basicMetrics)
+}
+
+// newOptions takes functional options and returns options.
+func newOptions(opts ...Option) *options {
+	cfg := &options{
+		metrics: basicMetrics,
+		name:    "default",
+	}
+
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	return cfg
+}
+
+// bodySize returns the maximum body size of the request
+func (o *options) bodySize(r *http.Request) int64 {
+	if size, ok := o.routeBodies[r.URL.Path]; ok {
+		return size
+	}
+	if size, ok := o.routeBodies[r.Pattern]; ok && len(r.Pattern) > 0 {
+		return size
+	}
+
+	return o.maxBody
+}
+
+// check returns the limit violated by the request line or headers
+func (o *options) check(r *http.Request, maxBody int64) *rejection {
+	uri := r.RequestURI
+	if len(uri) == 0 {
+		uri = r.URL.RequestURI()
+	}
+	if o.maxURL > 0 && len(uri) > o.maxURL {
+		return &rejection{reason: ReasonURLLength, status: http.StatusRequestURITooLong, limit: int64(o.maxURL)}
+	}
+
+	if o.maxHeaders > 0 || o.maxHeader > 0 {
+		count, size := 0, 0
+		for name, values := range r.Header {
+			count += len(values)
+			for _, value := range values {
+				size += len(name) + len(value)
+			}
+		}
+		if o.maxHeaders > 0 && count > o.maxHeaders {
+			return &rejection{reason: ReasonHeaderCount, status: http.StatusRequestHeaderFieldsTooLarge,
+				limit: int64(o.maxHeaders)}
+		}
+		if o.maxHeader > 0 && size > o.maxHeader {
+			return &rejection{reason: ReasonHeaderSize, status: http.StatusRequestHeaderFieldsTooLarge,
+				limit: int64(o.maxHeader)}
+		}
+	}
+
+	if maxBody > 0 && r.ContentLength > maxBody {
+		return &rejection{reason: ReasonBodySize, status: http.StatusRequestEntityTooLarge, limit: maxBody}
+	}
+
+	return nil
+}
+
+// Limited will reject requests exceeding the limits of the URL length (414), the number or size of headers (431), the
+// body size (413) and the minimum read rate of the body (408). Limits are disabled by default. Violations found while
+// the handler reads the body replace its response unless it was already committed. Rejections are logged and counted
+// per reason.
+func Limited(options ...Option) middlewares.Middleware {
+	o := newOptions(options...)
+
+	fn := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reject := func(w http.ResponseWriter, violation *rejection) {
+				if violation.status == http.StatusRequestTimeout || violation.status == http.StatusRequestEntityTooLarge {
+					// rest of the body is not going to be read
+					w.Header().Set("Connection", "close")
+				}
+				http.Error(w, fmt.Sprintf("%d - %s", violation.status, http.StatusText(violation.status)),
+					violation.status)
+			}
+			record := func(violation *rejection, committed bool) {
+				o.metrics.GetRejected().WithLabelValues(o.name, violation.reason).Inc()
+				if logger := logging.FromRequest(r); logger != nil {
+					logger.With("limit_reason", violation.reason, "limit", violation.limit, "committed", committed).
+						Warn("request rejected")
+				}
+			}
+
+			maxBody := o.bodySize(r)
+			if violation := o.check(r, maxBody); violation != nil {
+				record(violation, false)
+				reject(w, violation)
+				return
+			}
+			if r.Body == nil || r.Body == http.NoBody || (maxBody <= 0 && o.minRate <= 0) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			body := &bodyReader{
+				ReadCloser: r.Body,
+				controller: http.NewResponseController(w),
+				maxSize:    maxBody,
+				rate:       o.minRate,
+				grace:      o.rateGrace,
+				start:      time.Now(),
+				deadlines:  true,
+			}
+			if maxBody > 0 {
+				body.ReadCloser = http.MaxBytesReader(w, r.Body, maxBody)
+			}
+			defer body.finish()
+			r.Body = body
+
+			guard := &guardWriter{ResponseWriter: w, body: body, reject: reject}
+			h.ServeHTTP(guard, r)
+
+			if body.violation != nil {
+				committed := guard.written && !guard.discard
+				if !guard.written {
+					guard.WriteHeader(http.StatusOK)
+				}
+				record(body.violation, committed)
+			}
+		})
+	}
+
+	return fn
+}
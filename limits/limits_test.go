@@ -0,0 +1,187 @@
+package limits
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// echo returns the request body or 400 if it could not be read
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, _ = w.Write(body)
+})
+
+func TestLimited(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := newDefaultMetrics()
+	assert.NoError(t, registry.Register(metrics), "could not register limits metrics")
+
+	logWatcher, logs := observer.New(zapcore.DebugLevel)
+	customLog := logging.LogGetter(func() (*zap.SugaredLogger, error) {
+		return zap.New(logWatcher).Sugar(), nil
+	})
+
+	handler := logging.InContext(logging.WithLogger(customLog))(Limited(WithMetrics(metrics), WithName("api"),
+		WithMaxURLLength(20), WithMaxHeaders(3, 64), WithMaxBodySize(8))(echo))
+
+	tests := map[string]struct {
+		request func() *http.Request
+		status  int
+		body    string
+	}{
+		"within limits": {
+			request: func() *http.Request { return httptest.NewRequest("POST", "/items", strings.NewReader("payload")) },
+			status:  http.StatusOK,
+			body:    "payload",
+		},
+		"url too long": {
+			request: func() *http.Request { return httptest.NewRequest("GET", "/items?filter=very-long", nil) },
+			status:  http.StatusRequestURITooLong,
+		},
+		"too many headers": {
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Header["X-Many"] = []string{"1", "2", "3", "4"}
+				return r
+			},
+			status: http.StatusRequestHeaderFieldsTooLarge,
+		},
+		"headers too large": {
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Header.Set("X-Large", strings.Repeat("a", 64))
+				return r
+			},
+			status: http.StatusRequestHeaderFieldsTooLarge,
+		},
+		"content length too large": {
+			request: func() *http.Request { return httptest.NewRequest("POST", "/", strings.NewReader("too large payload")) },
+			status:  http.StatusRequestEntityTooLarge,
+		},
+		"body too large": {
+			request: func() *http.Request {
+				r := httptest.NewRequest("POST", "/", strings.NewReader("too large payload"))
+				r.ContentLength = -1
+				return r
+			},
+			status: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, test.request())
+			assert.Equal(t, test.status, rec.Code, "invalid status")
+			if len(test.body) > 0 {
+				assert.Equal(t, test.body, rec.Body.String(), "invalid body")
+			}
+		})
+	}
+
+	body := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, body, `http_limits_rejected_total{handler_name="api",reason="url_length"} 1`, "rejection not counted")
+	assert.Contains(t, body, `http_limits_rejected_total{handler_name="api",reason="header_count"} 1`, "rejection not counted")
+	assert.Contains(t, body, `http_limits_rejected_total{handler_name="api",reason="header_size"} 1`, "rejection not counted")
+	assert.Contains(t, body, `http_limits_rejected_total{handler_name="api",reason="body_size"} 2`, "rejection not counted")
+
+	rejections := logs.FilterMessage("request rejected")
+	assert.Equal(t, 5, rejections.Len(), "rejections not logged")
+	assert.Equal(t, 1, rejections.FilterField(zap.String("limit_reason", ReasonURLLength)).Len(), "reason not logged")
+}
+
+func TestLimitedRouteBodySizes(t *testing.T) {
+	handler := Limited(WithMetrics(newDefaultMetrics()), WithMaxBodySize(4),
+		WithRouteBodySizes(map[string]int64{"/upload": 0, "POST /items/{id}": 16}))(echo)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/upload", strings.NewReader("unlimited payload")))
+	assert.Equal(t, http.StatusOK, rec.Code, "route limit should be disabled")
+
+	r := httptest.NewRequest("POST", "/items/1", strings.NewReader("small payload"))
+	r.Pattern = "POST /items/{id}"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusOK, rec.Code, "pattern limit should be used")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/other", strings.NewReader("payload")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, "default limit should be used")
+}
+
+func TestLimitedSlowBody(t *testing.T) {
+	metrics := newDefaultMetrics()
+	readErr := make(chan error, 1)
+	handler := Limited(WithMetrics(metrics), WithMinReadRate(1000, 20*time.Millisecond))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := io.ReadAll(r.Body)
+			readErr <- err
+			http.Error(w, "could not read body", http.StatusBadRequest)
+		}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if !assert.NoError(t, err, "could not connect") {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	_, err = fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: test\r\nContent-Length: 100\r\n\r\nx")
+	assert.NoError(t, err, "could not send request")
+
+	select {
+	case err := <-readErr:
+		assert.True(t, errors.Is(err, ErrBodyTooSlow), "slow read should be interrupted")
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "slow read was not interrupted")
+		return
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if assert.NoError(t, err, "could not read response") {
+		assert.Equal(t, http.StatusRequestTimeout, resp.StatusCode, "invalid status")
+		assert.True(t, resp.Close, "connection should be closed")
+		_ = resp.Body.Close()
+	}
+}
+
+func TestLimitedReadAfterEOF(t *testing.T) {
+	ctxErr := make(chan error, 1)
+	handler := Limited(WithMinReadRate(1000, 20*time.Millisecond))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_, _ = io.Copy(io.Discard, r.Body)
+			time.Sleep(200 * time.Millisecond)
+			ctxErr <- r.Context().Err()
+		}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if assert.NoError(t, err, "could not send request") {
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "invalid status")
+		_ = resp.Body.Close()
+	}
+	assert.NoError(t, <-ctxErr, "request should not be canceled after the body was read")
+}
@@ -0,0 +1,264 @@
+package loadshed
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is an algorithm computing the concurrency limit from latency samples of handled requests
+type Limit interface {
+	// Limit returns the current concurrency limit
+	Limit() int
+	// OnSample updates the limit with the latency of a handled request, the number of requests in flight when it
+	// was started and whether it was dropped (eg. timed out or rejected by a dependency)
+	OnSample(rtt time.Duration, inFlight int, dropped bool)
+}
+
+// fixedLimit never changes
+type fixedLimit int
+
+// Fixed returns a static concurrency limit
+func Fixed(limit int) Limit {
+	return fixedLimit(limit)
+}
+
+// Limit implements Limit interface
+func (l fixedLimit) Limit() int {
+	return int(l)
+}
+
+// OnSample implements Limit interface
+func (l fixedLimit) OnSample(time.Duration, int, bool) {}
+
+// AIMDConfig configures the AIMD limit. Zero values are replaced with defaults.
+type AIMDConfig struct {
+	// Initial limit (default: 20)
+	Initial int
+	// Min and Max bound the limit (default: 1 and 1000)
+	Min int
+	Max int
+	// Backoff is the ratio the limit is multiplied by when a request is dropped (default: 0.9)
+	Backoff float64
+	// Timeout is the latency above which requests are considered dropped (default: 5s)
+	Timeout time.Duration
+}
+
+// aimd is additive increase / multiplicative decrease limit
+type aimd struct {
+	lock   sync.Mutex
+	config AIMDConfig
+	limit  int
+}
+
+// NewAIMD creates the limit that grows by one for every successful request when it is utilized and is reduced by the
+// backoff ratio for every dropped (or too slow) request
+func NewAIMD(config AIMDConfig) Limit {
+	config.Initial = defaultInt(config.Initial, 20)
+	config.Min = defaultInt(config.Min, 1)
+	config.Max = defaultInt(config.Max, 1000)
+	if config.Backoff <= 0 || config.Backoff >= 1 {
+		config.Backoff = 0.9
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+
+	return &aimd{config: config, limit: config.Initial}
+}
+
+// Limit implements Limit interface
+func (l *aimd) Limit() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.limit
+}
+
+// OnSample implements Limit interface
+func (l *aimd) OnSample(rtt time.Duration, inFlight int, dropped bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	switch {
+	case dropped || rtt > l.config.Timeout:
+		l.limit = max(l.config.Min, int(float64(l.limit)*l.config.Backoff))
+	case inFlight*2 >= l.limit:
+		// grow only if the limit is actually utilized
+		l.limit = min(l.config.Max, l.limit+1)
+	}
+}
+
+// VegasConfig configures the Vegas limit. Zero values are replaced with defaults.
+type VegasConfig struct {
+	// Initial limit (default: 20)
+	Initial int
+	// Min and Max bound the limit (default: 1 and 1000)
+	Min int
+	Max int
+	// Alpha and Beta are the estimated queue sizes below which the limit grows and above which it is reduced
+	// (default: 3 and 6)
+	Alpha float64
+	Beta  float64
+	// ProbeInterval is the number of samples after which the no-load latency is measured again (default: 1000)
+	ProbeInterval int
+}
+
+// vegas is the delay based limit inspired by TCP Vegas
+type vegas struct {
+	lock      sync.Mutex
+	config    VegasConfig
+	limit     float64
+	rttNoLoad time.Duration
+	samples   int
+}
+
+// NewVegas creates the limit that estimates the queue size from the difference between the minimum (no-load) latency
+// and the latency of handled requests. The limit grows while the queue is small and is reduced when it builds up.
+func NewVegas(config VegasConfig) Limit {
+	config.Initial = defaultInt(config.Initial, 20)
+	config.Min = defaultInt(config.Min, 1)
+	config.Max = defaultInt(config.Max, 1000)
+	config.ProbeInterval = defaultInt(config.ProbeInterval, 1000)
+	if config.Alpha <= 0 {
+		config.Alpha = 3
+	}
+	if config.Beta <= config.Alpha {
+		config.Beta = 2 * config.Alpha
+	}
+
+	return &vegas{config: config, limit: float64(config.Initial)}
+}
+
+// Limit implements Limit interface
+func (l *vegas) Limit() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return int(l.limit)
+}
+
+// OnSample implements Limit interface
+func (l *vegas) OnSample(rtt time.Duration, inFlight int, dropped bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if rtt <= 0 {
+		return
+	}
+
+	l.samples++
+	if l.samples >= l.config.ProbeInterval {
+		// latency of the dependencies might have changed for good
+		l.samples = 0
+		l.rttNoLoad = 0
+	}
+	if l.rttNoLoad == 0 || rtt < l.rttNoLoad {
+		l.rttNoLoad = rtt
+		return
+	}
+
+	step := math.Max(1, math.Log10(l.limit))
+	queue := l.limit * (1 - float64(l.rttNoLoad)/float64(rtt))
+	switch {
+	case dropped || queue > l.config.Beta:
+		l.limit -= step
+	case queue < l.config.Alpha && float64(inFlight)*2 >= l.limit:
+		l.limit += step
+	}
+	l.limit = math.Max(float64(l.config.Min), math.Min(float64(l.config.Max), l.limit))
+}
+
+// GradientConfig configures the gradient limit. Zero values are replaced with defaults.
+type GradientConfig struct {
+	// Initial limit (default: 20)
+	Initial int
+	// Min and Max bound the limit (default: 1 and 1000)
+	Min int
+	Max int
+	// Tolerance is the ratio of the short term to the long term latency tolerated before the limit is reduced
+	// (default: 1.5)
+	Tolerance float64
+	// Smoothing is the weight of the new limit (default: 0.2)
+	Smoothing float64
+	// LongWindow is the number of samples of the long term latency average (default: 600)
+	LongWindow int
+}
+
+// gradient compares the short and long term latency averages
+type gradient struct {
+	lock    sync.Mutex
+	config  GradientConfig
+	limit   float64
+	longRtt float64
+	samples int
+}
+
+// NewGradient creates the limit that adjusts the limit by the gradient of the long term latency average to the
+// latency of handled requests (like Netflix Gradient2 limit). It reacts to latency changes without measuring the
+// minimum latency.
+func NewGradient(config GradientConfig) Limit {
+	config.Initial = defaultInt(config.Initial, 20)
+	config.Min = defaultInt(config.Min, 1)
+	config.Max = defaultInt(config.Max, 1000)
+	config.LongWindow = defaultInt(config.LongWindow, 600)
+	if config.Tolerance < 1 {
+		config.Tolerance = 1.5
+	}
+	if config.Smoothing <= 0 || config.Smoothing > 1 {
+		config.Smoothing = 0.2
+	}
+
+	return &gradient{config: config, limit: float64(config.Initial)}
+}
+
+// Limit implements Limit interface
+func (l *gradient) Limit() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return int(l.limit)
+}
+
+// OnSample implements Limit interface
+func (l *gradient) OnSample(rtt time.Duration, inFlight int, dropped bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if rtt <= 0 {
+		return
+	}
+
+	shortRtt := float64(rtt)
+	// exponential moving average warmed up with a simple average of the first samples
+	if l.samples < l.config.LongWindow {
+		l.samples++
+		l.longRtt += (shortRtt - l.longRtt) / float64(l.samples)
+	} else {
+		factor := 2 / float64(l.config.LongWindow+1)
+		l.longRtt = l.longRtt*(1-factor) + shortRtt*factor
+	}
+	// recover faster from latency spikes that raised the long term average
+	if l.longRtt/shortRtt > 2 {
+		l.longRtt *= 0.95
+	}
+
+	// do not grow the limit if it is not utilized
+	if !dropped && float64(inFlight) < l.limit/2 {
+		return
+	}
+
+	ratio := math.Max(0.5, math.Min(1, l.config.Tolerance*l.longRtt/shortRtt))
+	if dropped {
+		ratio = 0.5
+	}
+	newLimit := l.limit*ratio + math.Sqrt(l.limit)
+	newLimit = l.limit*(1-l.config.Smoothing) + newLimit*l.config.Smoothing
+	l.limit = math.Max(float64(l.config.Min), math.Min(float64(l.config.Max), newLimit))
+}
+
+// defaultInt returns the default value if the value is not positive
+func defaultInt(value, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+
+	return value
+}
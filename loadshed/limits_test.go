@@ -0,0 +1,66 @@
+package loadshed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixed(t *testing.T) {
+	limit := Fixed(5)
+	limit.OnSample(time.Hour, 5, true)
+	assert.Equal(t, 5, limit.Limit(), "fixed limit should not change")
+}
+
+func TestAIMD(t *testing.T) {
+	limit := NewAIMD(AIMDConfig{Initial: 10, Max: 11, Timeout: time.Second})
+
+	limit.OnSample(time.Millisecond, 1, false)
+	assert.Equal(t, 10, limit.Limit(), "limit should not grow if it is not utilized")
+	limit.OnSample(time.Millisecond, 5, false)
+	assert.Equal(t, 11, limit.Limit(), "limit should grow if it is utilized")
+	limit.OnSample(time.Millisecond, 11, false)
+	assert.Equal(t, 11, limit.Limit(), "limit should not exceed max")
+
+	limit.OnSample(time.Millisecond, 11, true)
+	assert.Equal(t, 9, limit.Limit(), "limit should back off when request is dropped")
+	limit.OnSample(2*time.Second, 9, false)
+	assert.Equal(t, 8, limit.Limit(), "limit should back off when request times out")
+}
+
+func TestVegas(t *testing.T) {
+	limit := NewVegas(VegasConfig{Initial: 10})
+
+	limit.OnSample(10*time.Millisecond, 10, false)
+	assert.Equal(t, 10, limit.Limit(), "first sample should only measure no-load latency")
+	limit.OnSample(11*time.Millisecond, 10, false)
+	assert.Equal(t, 11, limit.Limit(), "limit should grow when the queue is small")
+	limit.OnSample(11*time.Millisecond, 2, false)
+	assert.Equal(t, 11, limit.Limit(), "limit should not grow if it is not utilized")
+	limit.OnSample(30*time.Millisecond, 11, false)
+	assert.Equal(t, 9, limit.Limit(), "limit should be reduced when the queue builds up")
+	limit.OnSample(5*time.Millisecond, 9, true)
+	assert.Equal(t, 9, limit.Limit(), "new minimum latency should only be measured")
+	limit.OnSample(10*time.Millisecond, 9, true)
+	assert.Equal(t, 8, limit.Limit(), "limit should be reduced when request is dropped")
+}
+
+func TestGradient(t *testing.T) {
+	limit := NewGradient(GradientConfig{Initial: 20, LongWindow: 10})
+
+	for i := 0; i < 10; i++ {
+		limit.OnSample(10*time.Millisecond, 20, false)
+	}
+	steady := limit.Limit()
+	assert.Greater(t, steady, 20, "limit should grow while latency is steady")
+
+	for i := 0; i < 5; i++ {
+		limit.OnSample(100*time.Millisecond, steady, false)
+	}
+	assert.Less(t, limit.Limit(), steady, "limit should be reduced when latency grows")
+
+	reduced := limit.Limit()
+	limit.OnSample(10*time.Millisecond, 1, false)
+	assert.Equal(t, reduced, limit.Limit(), "limit should not change if it is not utilized")
+}
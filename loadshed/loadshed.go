@@ -0,0 +1,275 @@
+package loadshed
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/harnash/go-middlewares"
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PriorityFunc returns the priority of a request
+type PriorityFunc func(r *http.Request) Priority
+
+type options struct {
+	metrics    Metrics
+	name       string
+	priority   PriorityFunc
+	maxQueue   int
+	maxWait    time.Duration
+	retryAfter time.Duration
+}
+
+// Option represents a load shedding option.
+type Option func(*options)
+
+// WithMetrics sets custom metric collector/container for load shedding metrics
+func WithMetrics(metrics Metrics) Option {
+	return func(o *options) {
+		o.metrics = metrics
+	}
+}
+
+// WithName sets the name of the limiter used in metrics ("default" by default)
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithPriority sets the function returning the priority of a request (all requests have Normal priority by default)
+func WithPriority(priority PriorityFunc) Option {
+	return func(o *options) {
+		o.priority = priority
+	}
+}
+
+// WithQueue enables queueing of up to size requests above the concurrency limit for at most maxWait. Without the
+// queue requests above the limit are shed immediately.
+func WithQueue(size int, maxWait time.Duration) Option {
+	return func(o *options) {
+		o.maxQueue = size
+		o.maxWait = maxWait
+	}
+}
+
+// WithRetryAfter sets the value of the Retry-After header of shed requests (1s by default)
+func WithRetryAfter(retryAfter time.Duration) Option {
+	return func(o *options) {
+		o.retryAfter = retryAfter
+	}
+}
+
+// PathPriority returns the priority of the request path (or the http.ServeMux pattern) found in the map. Other
+// requests get the fallback priority.
+func PathPriority(priorities map[string]Priority, fallback Priority) PriorityFunc {
+	return func(r *http.Request) Priority {
+		if p, ok := priorities[r.URL.Path]; ok {
+			return p
+		}
+		if p, ok := priorities[r.Pattern]; ok && len(r.Pattern) > 0 {
+			return p
+		}
+
+		return fallback
+	}
+}
+
+// Metrics defines interface for custom metric collector/container
+type Metrics interface {
+	prometheus.Collector
+	GetLimit() *prometheus.GaugeVec
+	GetInFlight() *prometheus.GaugeVec
+	GetQueued() *prometheus.GaugeVec
+	GetRejected() *prometheus.CounterVec
+}
+
+// defaultMetrics holds all the metrics of load shedding limiters
+type defaultMetrics struct {
+	limit    *prometheus.GaugeVec
+	inFlight *prometheus.GaugeVec
+	queued   *prometheus.GaugeVec
+	rejected *prometheus.CounterVec
+}
+
+var basicMetrics = newDefaultMetrics()
+
+// GetLimit return metric that tracks the current concurrency limit
+func (s defaultMetrics) GetLimit() *prometheus.GaugeVec {
+	return s.limit
+}
+
+// GetInFlight return metric that tracks the number of admitted requests being handled
+func (s defaultMetrics) GetInFlight() *prometheus.GaugeVec {
+	return s.inFlight
+}
+
+// GetQueued return metric that tracks the number of requests waiting in the queue
+func (s defaultMetrics) GetQueued() *prometheus.GaugeVec {
+	return s.queued
+}
+
+// GetRejected return metric that counts shed requests per priority
+func (s defaultMetrics) GetRejected() *prometheus.CounterVec {
+	return s.rejected
+}
+
+// newDefaultMetrics creates new load shedding metrics
+func newDefaultMetrics() Metrics {
+	limit := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_loadshed_limit",
+		Help: "current concurrency limit",
+	}, []string{"limiter"})
+
+	inFlight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_loadshed_requests_in_flight",
+		Help: "number of admitted requests being handled",
+	}, []string{"limiter"})
+
+	queued := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_loadshed_requests_queued",
+		Help: "number of requests waiting for admission",
+	}, []string{"limiter"})
+
+	rejected := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_loadshed_rejected_total",
+		Help: "number of shed requests per priority",
+	}, []string{"limiter", "priority"})
+
+	return defaultMetrics{limit: limit, inFlight: inFlight, queued: queued, rejected: rejected}
+}
+
+// Describe implements prometheus Collector interface.
+func (s defaultMetrics) Describe(in chan<- *prometheus.Desc) {
+	s.limit.Describe(in)
+	s.inFlight.Describe(in)
+	s.queued.Describe(in)
+	s.rejected.Describe(in)
+}
+
+// Collect implements prometheus Collector interface.
+func (s defaultMetrics) Collect(in chan<- prometheus.Metric) {
+	s.limit.Collect(in)
+	s.inFlight.Collect(in)
+	s.queued.Collect(in)
+	s.rejected.Collect(in)
+}
+
+// RegisterDefaultMetrics will register default load shedding metrics instance in Prometheus. This is only needed if
+// any handlers are protected with default metrics (not overridden by WithMetrics() option)
+func RegisterDefaultMetrics(registerer prometheus.Registerer) error {
+	return registerer.Register(basicMetrics)
+}
+
+// UnregisterDefaultMetrics is a companion function to RegisterDefaultMetrics and must be called if RegisterDefaultMetrics
+// is used to cleanup the metrics in Prometheus
+func UnregisterDefaultMetrics(registerer prometheus.Registerer) {
+	registerer.Unregister(basicMetrics)
+}
+
+// newOptions takes functional options and returns options.
+func newOptions(opts ...Option) *options {
+	cfg := &options{
+		metrics:    basicMetrics,
+		name:       "default",
+		priority:   func(*http.Request) Priority { return Normal },
+		retryAfter: time.Second,
+	}
+
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	return cfg
+}
+
+// Shed will limit the number of concurrently handled requests to the limit adjusted by the algorithm (see: NewAIMD,
+// NewVegas, NewGradient) from the latency of handled requests. Requests above the limit wait in the queue (if
+// enabled) and are shed with 503 response and the Retry-After header when the queue is full or the wait is too long.
+// All handlers wrapped by the returned middleware share the limit. Time spent in the queue is recorded with
+// middlewares.RecordQueueWait for the middlewares placed before this one (eg. http_metrics.Measured, tracing.Traced).
+func Shed(limit Limit, options ...Option) middlewares.Middleware {
+	o := newOptions(options...)
+	l := &limiter{limit: limit, maxQueue: o.maxQueue, maxWait: o.maxWait}
+	limitGauge := o.metrics.GetLimit().WithLabelValues(o.name)
+	inFlightGauge := o.metrics.GetInFlight().WithLabelValues(o.name)
+	queuedGauge := o.metrics.GetQueued().WithLabelValues(o.name)
+	retryAfter := strconv.FormatInt(int64(math.Ceil(o.retryAfter.Seconds())), 10)
+	limitGauge.Set(float64(limit.Limit()))
+
+	updateGauges := func() {
+		inFlight, queued := l.state()
+		inFlightGauge.Set(float64(inFlight))
+		queuedGauge.Set(float64(queued))
+		limitGauge.Set(float64(limit.Limit()))
+	}
+
+	fn := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			priority := o.priority(r)
+			admitted, wait := l.acquire(r.Context(), priority)
+			middlewares.RecordQueueWait(r.Context(), wait)
+			if !admitted {
+				updateGauges()
+				o.metrics.GetRejected().WithLabelValues(o.name, priority.String()).Inc()
+				if logger := logging.FromRequest(r); logger != nil {
+					logger.With("loadshed_limiter", o.name, "priority", priority.String(), "queue_wait_ns",
+						wait.Nanoseconds()).Warn("request shed")
+				}
+				w.Header().Set("Retry-After", retryAfter)
+				http.Error(w, "503 - Service Unavailable", http.StatusServiceUnavailable)
+				return
+			}
+
+			inFlight, _ := l.state()
+			updateGauges()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			start := time.Now()
+			defer func() {
+				// critical requests bypass the limit so their latency should not affect it, neither should requests
+				// cancelled by the client
+				sample := priority != Critical && !errors.Is(r.Context().Err(), context.Canceled)
+				l.release(inFlight, time.Since(start), rec.dropped(), sample)
+				updateGauges()
+			}()
+
+			h.ServeHTTP(rec, r)
+		})
+	}
+
+	return fn
+}
+
+// statusRecorder captures the status of the response to detect dropped requests
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements net/http.ResponseWriter's WriteHeader()
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Flush implements net/http.Flusher interface
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the original http.ResponseWriter (used by net/http.ResponseController)
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// dropped reports if the response signals overload of the handler or its dependencies
+func (rec *statusRecorder) dropped() bool {
+	return rec.status == http.StatusServiceUnavailable || rec.status == http.StatusGatewayTimeout
+}
@@ -0,0 +1,128 @@
+package loadshed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/harnash/go-middlewares/http_metrics"
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/harnash/go-middlewares/tracing"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestShed(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := newDefaultMetrics()
+	assert.NoError(t, registry.Register(metrics), "could not register load shedding metrics")
+
+	logWatcher, logs := observer.New(zapcore.DebugLevel)
+	customLog := logging.LogGetter(func() (*zap.SugaredLogger, error) {
+		return zap.New(logWatcher).Sugar(), nil
+	})
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-unblock
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	priorities := PathPriority(map[string]Priority{"/health": Critical}, Normal)
+	handler := logging.InContext(logging.WithLogger(customLog))(
+		Shed(Fixed(1), WithMetrics(metrics), WithName("api"), WithPriority(priorities), WithRetryAfter(1500*time.Millisecond))(blocking))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/items", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "request above the limit should be shed")
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"), "invalid retry after header")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "critical request should never be shed")
+
+	body := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, body, `http_loadshed_limit{limiter="api"} 1`, "limit not exposed")
+	assert.Contains(t, body, `http_loadshed_requests_in_flight{limiter="api"} 1`, "in flight requests not exposed")
+	assert.Contains(t, body, `http_loadshed_rejected_total{limiter="api",priority="normal"} 1`, "shed requests not counted")
+
+	close(unblock)
+	<-done
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/items", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "request should be admitted after the slot is released")
+
+	if assert.Equal(t, 1, logs.FilterMessage("request shed").Len(), "shed request not logged") {
+		assert.Equal(t, "normal", logs.FilterMessage("request shed").All()[0].ContextMap()["priority"], "priority not logged")
+	}
+}
+
+func TestShedQueueWait(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	httpMetrics, err := http_metrics.NewMetrics(registry)
+	assert.NoError(t, err, "could not create http metrics")
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-unblock
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := tracing.Traced(tracing.WithTracer(mocktracer.New()), tracing.WithServerTiming())(
+		http_metrics.Measured(http_metrics.WithName("api"), http_metrics.WithMetrics(httpMetrics))(
+			Shed(Fixed(1), WithMetrics(newDefaultMetrics()), WithQueue(1, time.Minute))(blocking)))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+	}()
+	<-started
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(unblock)
+	}()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/items", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "queued request should be admitted")
+	<-done
+
+	timing := regexp.MustCompile(`^queue;dur=(\d+\.\d{3}), handler;dur=(\d+\.\d{3}), total;dur=\d+\.\d{3}$`).
+		FindStringSubmatch(rec.Header().Get("Server-Timing"))
+	if assert.Len(t, timing, 3, "queue wait not reported in Server-Timing header") {
+		wait, err := strconv.ParseFloat(timing[1], 64)
+		assert.NoError(t, err, "invalid queue wait")
+		assert.GreaterOrEqual(t, wait, 40.0, "queue wait too short")
+		handled, err := strconv.ParseFloat(timing[2], 64)
+		assert.NoError(t, err, "invalid handler duration")
+		assert.Less(t, handled, 40.0, "queue wait should not be a part of the handler duration")
+	}
+
+	body := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, body, `http_handler_queue_wait_seconds_bucket{handler_name="api",le="0.005"} 1`, "admitted request should not wait")
+	assert.Contains(t, body, `http_handler_queue_wait_seconds_count{handler_name="api"} 2`, "queue wait not reported")
+}
@@ -0,0 +1,180 @@
+package loadshed
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority defines the order in which queued requests are admitted and which requests are shed first
+type Priority int
+
+const (
+	// Low priority requests are the first to be shed
+	Low Priority = iota
+	// Normal is the default priority
+	Normal
+	// High priority requests are admitted before Normal and Low priority requests
+	High
+	// Critical requests (eg. health checks) are never shed nor queued
+	Critical
+)
+
+// String returns the name of the priority
+func (p Priority) String() string {
+	switch p {
+	case Low:
+		return "low"
+	case Normal:
+		return "normal"
+	case High:
+		return "high"
+	case Critical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+// waiter is a queued request
+type waiter struct {
+	priority Priority
+	seq      uint64
+	index    int
+	// ready receives true when the request is admitted and false when it is evicted by a higher priority request
+	ready chan bool
+}
+
+// waiters is a priority queue of requests (highest priority first, FIFO within the same priority)
+type waiters []*waiter
+
+func (q waiters) Len() int { return len(q) }
+
+func (q waiters) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waiters) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waiters) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waiters) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
+
+// lowest returns the lowest priority request queued last
+func (q waiters) lowest() *waiter {
+	var lowest *waiter
+	for _, w := range q {
+		if lowest == nil || w.priority < lowest.priority || (w.priority == lowest.priority && w.seq > lowest.seq) {
+			lowest = w
+		}
+	}
+
+	return lowest
+}
+
+// limiter admits requests up to the concurrency limit queueing the ones above it
+type limiter struct {
+	lock     sync.Mutex
+	limit    Limit
+	inFlight int
+	queue    waiters
+	seq      uint64
+	maxQueue int
+	maxWait  time.Duration
+}
+
+// acquire admits the request or queues it until it can be admitted. It returns false if the request should be shed
+// and the time the request spent in the queue.
+func (l *limiter) acquire(ctx context.Context, priority Priority) (bool, time.Duration) {
+	l.lock.Lock()
+	if priority == Critical || (l.inFlight < l.limit.Limit() && len(l.queue) == 0) {
+		l.inFlight++
+		l.lock.Unlock()
+		return true, 0
+	}
+
+	if l.maxQueue == 0 || l.maxWait <= 0 {
+		l.lock.Unlock()
+		return false, 0
+	}
+	if len(l.queue) >= l.maxQueue {
+		lowest := l.queue.lowest()
+		if lowest.priority >= priority {
+			l.lock.Unlock()
+			return false, 0
+		}
+		heap.Remove(&l.queue, lowest.index)
+		lowest.ready <- false
+	}
+
+	l.seq++
+	w := &waiter{priority: priority, seq: l.seq, ready: make(chan bool, 1)}
+	heap.Push(&l.queue, w)
+	l.lock.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(l.maxWait)
+	defer timer.Stop()
+
+	select {
+	case ok := <-w.ready:
+		return ok, time.Since(start)
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.lock.Lock()
+	if w.index >= 0 {
+		heap.Remove(&l.queue, w.index)
+		l.lock.Unlock()
+		return false, time.Since(start)
+	}
+	l.lock.Unlock()
+
+	// the request was admitted or evicted in the meantime
+	return <-w.ready, time.Since(start)
+}
+
+// release frees the slot of a handled request admitting queued requests. Latency sample is passed to the limit if
+// requested.
+func (l *limiter) release(inFlight int, rtt time.Duration, dropped, sample bool) {
+	if sample {
+		l.limit.OnSample(rtt, inFlight, dropped)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.inFlight--
+	for len(l.queue) > 0 && l.inFlight < l.limit.Limit() {
+		w := heap.Pop(&l.queue).(*waiter)
+		l.inFlight++
+		w.ready <- true
+	}
+}
+
+// state returns the number of requests in flight and in the queue
+func (l *limiter) state() (int, int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.inFlight, len(l.queue)
+}
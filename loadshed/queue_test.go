@@ -0,0 +1,83 @@
+package loadshed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// enqueue starts acquiring the slot in the background and waits until the request is queued
+func enqueue(l *limiter, ctx context.Context, priority Priority) chan bool {
+	result := make(chan bool, 1)
+	seq := queueSeq(l)
+	go func() {
+		ok, _ := l.acquire(ctx, priority)
+		result <- ok
+	}()
+	for queueSeq(l) == seq {
+		time.Sleep(time.Millisecond)
+	}
+
+	return result
+}
+
+// queueSeq returns the sequence number of the last queued request
+func queueSeq(l *limiter) uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.seq
+}
+
+func TestLimiterPriorities(t *testing.T) {
+	l := &limiter{limit: Fixed(1), maxQueue: 2, maxWait: time.Minute}
+	ctx := context.Background()
+
+	ok, _ := l.acquire(ctx, Normal)
+	assert.True(t, ok, "request within limit should be admitted")
+	ok, _ = l.acquire(ctx, Critical)
+	assert.True(t, ok, "critical request should bypass the limit")
+
+	low := enqueue(l, ctx, Low)
+	normal := enqueue(l, ctx, Normal)
+	high := enqueue(l, ctx, High)
+	assert.False(t, <-low, "lowest priority request should be evicted from the full queue")
+	ok, _ = l.acquire(ctx, Low)
+	assert.False(t, ok, "low priority request should be shed when the queue is full")
+
+	l.release(1, time.Millisecond, false, false)
+	l.release(1, time.Millisecond, false, false)
+	assert.True(t, <-high, "high priority request should be admitted first")
+	select {
+	case <-normal:
+		assert.Fail(t, "normal priority request should wait")
+	default:
+	}
+
+	l.release(1, time.Millisecond, false, false)
+	assert.True(t, <-normal, "queued request should be admitted")
+}
+
+func TestLimiterWait(t *testing.T) {
+	l := &limiter{limit: Fixed(1), maxQueue: 10, maxWait: 20 * time.Millisecond}
+	ok, _ := l.acquire(context.Background(), Normal)
+	assert.True(t, ok, "request within limit should be admitted")
+
+	ok, wait := l.acquire(context.Background(), Normal)
+	assert.False(t, ok, "request should be shed after max wait")
+	assert.GreaterOrEqual(t, wait, 20*time.Millisecond, "invalid queue wait")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := enqueue(l, ctx, Normal)
+	cancel()
+	assert.False(t, <-result, "cancelled request should leave the queue")
+	_, queued := l.state()
+	assert.Equal(t, 0, queued, "cancelled request should be removed from the queue")
+
+	l = &limiter{limit: Fixed(1)}
+	_, _ = l.acquire(context.Background(), Normal)
+	ok, wait = l.acquire(context.Background(), High)
+	assert.False(t, ok, "requests should be shed immediately without the queue")
+	assert.Zero(t, wait, "request should not wait without the queue")
+}
@@ -5,17 +5,19 @@ import (
 	"time"
 
 	"github.com/harnash/go-middlewares"
+	"github.com/harnash/go-middlewares/realip"
 )
 
-//LoggingResponseWriter is a wrapper around ResponseWriter used to capture HTTP status code of responses
+//LoggingResponseWriter is a wrapper around ResponseWriter used to capture HTTP status code and size of responses
 type LoggingResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	written    int64
 }
 
 //NewLoggingResponseWriter creates new LoggingResponseWriter instance wrapped around net/http.ResponseWriter
 func NewLoggingResponseWriter(w http.ResponseWriter) *LoggingResponseWriter {
-	return &LoggingResponseWriter{w, http.StatusOK}
+	return &LoggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 }
 
 //WriteHeader implements net/http.ResponseWriter's WriteHeader()
@@ -24,23 +26,53 @@ func (lrw *LoggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
-//AccessLog is a simple access-log style logging middleware that will log all incoming request and response info
+//Write implements net/http.ResponseWriter's Write()
+func (lrw *LoggingResponseWriter) Write(b []byte) (int, error) {
+	n, err := lrw.ResponseWriter.Write(b)
+	lrw.written += int64(n)
+	return n, err
+}
+
+//Flush implements net/http.Flusher interface
+func (lrw *LoggingResponseWriter) Flush() {
+	if flusher, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+//Unwrap returns the original http.ResponseWriter (used by net/http.ResponseController)
+func (lrw *LoggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
+//AccessLog is a simple access-log style logging middleware that will log all incoming request and response info.
+//Content encoding applied by the middlewares later in the chain (eg. compression) is logged with the size of
+//the response before the encoding. The client IP is the one resolved by realip.Resolved placed earlier in the chain
+//or the address of the connection.
 func AccessLog() middlewares.Middleware {
 	fn := func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			logger := FromRequest(r)
+			logger := FromRequest(r).With("client_ip", realip.ClientIP(r))
 
 			logger.Info("incoming request")
 
+			ctx, encoding := middlewares.WithEncodingStats(r.Context())
+			r = r.WithContext(ctx)
+
 			wrappedWriter := NewLoggingResponseWriter(w)
 			t1 := time.Now()
 			h.ServeHTTP(wrappedWriter, r)
 			t2 := time.Now()
 
-			logger.With(
+			logger = logger.With(
 				"status", wrappedWriter.statusCode,
 				"duration_ns", t2.Sub(t1).Nanoseconds(),
-			).Info("response generated")
+				"response_size", wrappedWriter.written,
+			)
+			if name, uncompressed, _, ok := encoding.Get(); ok {
+				logger = logger.With("content_encoding", name, "response_size_uncompressed", uncompressed)
+			}
+			logger.Info("response generated")
 		})
 	}
 
@@ -2,9 +2,11 @@ package logging
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 
+	"github.com/harnash/go-middlewares/realip"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -34,3 +36,26 @@ func TestAccessLog(t *testing.T) {
 		assert.Equal(t, "response generated", logEntries[1].Message, "no proper access log message found")
 	}
 }
+
+func TestAccessLogClientIP(t *testing.T) {
+	logWatcher, logs := observer.New(zapcore.DebugLevel)
+	customLog := LogGetter(func() (*zap.SugaredLogger, error) {
+		return zap.New(logWatcher).Sugar(), nil
+	})
+	handler := InContext(WithLogger(customLog))(AccessLog()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:51234"
+	r.Header.Set(realip.ForwardedForHeader, "192.0.2.10")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	realip.Resolved(realip.WithTrustedProxies("10.0.0.0/8"))(handler).ServeHTTP(httptest.NewRecorder(), r)
+
+	if assert.Equal(t, 4, logs.Len(), "access log not emitted") {
+		logEntries := logs.TakeAll()
+		assert.Equal(t, "10.0.0.1", logEntries[0].ContextMap()["client_ip"], "connection address should be logged")
+		assert.Equal(t, "192.0.2.10", logEntries[2].ContextMap()["client_ip"], "resolved client IP should be logged")
+		assert.Equal(t, "192.0.2.10", logEntries[3].ContextMap()["client_ip"], "client IP should be logged with response")
+	}
+}
@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const queueWaitKey key = 462
+
+// QueueWait holds the time the request spent waiting in the queue of a concurrency limiter placed later in the chain
+type QueueWait struct {
+	lock     sync.Mutex
+	duration time.Duration
+	recorded bool
+}
+
+// WithQueueWait returns a copy of the context in which the queue wait time of the request can be recorded (see:
+// RecordQueueWait). If the context already holds the queue wait it is returned unchanged so all the middlewares
+// observing the request share it.
+func WithQueueWait(ctx context.Context) (context.Context, *QueueWait) {
+	if wait, ok := ctx.Value(queueWaitKey).(*QueueWait); ok {
+		return ctx, wait
+	}
+
+	wait := &QueueWait{}
+	return context.WithValue(ctx, queueWaitKey, wait), wait
+}
+
+// RecordQueueWait will record how long the request was waiting for its turn in a concurrency limiter. It is meant to
+// be called by limiting middlewares once the request is admitted or rejected.
+func RecordQueueWait(ctx context.Context, duration time.Duration) {
+	if wait, ok := ctx.Value(queueWaitKey).(*QueueWait); ok {
+		wait.lock.Lock()
+		defer wait.lock.Unlock()
+		wait.duration = duration
+		wait.recorded = true
+	}
+}
+
+// Get returns the recorded queue wait time and true if anything was recorded
+func (w *QueueWait) Get() (time.Duration, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.duration, w.recorded
+}
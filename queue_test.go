@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueWait(t *testing.T) {
+	RecordQueueWait(context.Background(), time.Second)
+
+	ctx, wait := WithQueueWait(context.Background())
+	_, ok := wait.Get()
+	assert.False(t, ok, "nothing should be recorded yet")
+
+	shared, sharedWait := WithQueueWait(ctx)
+	assert.Equal(t, ctx, shared, "context with queue wait should not be copied")
+	assert.Same(t, wait, sharedWait, "queue wait should be shared")
+
+	RecordQueueWait(shared, 0)
+	d, ok := wait.Get()
+	assert.True(t, ok, "zero queue wait not recorded")
+	assert.Zero(t, d, "invalid queue wait")
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/harnash/go-middlewares/realip"
+)
+
+type key int
+
+const principalKey key = 421
+
+// KeyFunc returns the key the request is limited by. Requests with empty key are not limited. Keys should be prefixed
+// with their kind so the keys of different kinds (eg. combined with FirstOf) never share the quota.
+type KeyFunc func(r *http.Request) string
+
+// prefixed returns the value prefixed with the kind of the key or an empty string if there is no value
+func prefixed(kind, value string) string {
+	if len(value) == 0 {
+		return ""
+	}
+
+	return kind + ":" + value
+}
+
+// ClientIP limits requests by the IP address of the client resolved by realip.Resolved or the address of the client
+// connection if the middleware was not used. Keys are prefixed with "ip:".
+func ClientIP(r *http.Request) string {
+	return prefixed("ip", realip.ClientIP(r))
+}
+
+// Header limits requests by the value of a given header (eg. API key). Keys are prefixed with "header:<name>:".
+func Header(name string) KeyFunc {
+	kind := "header:" + http.CanonicalHeaderKey(name)
+	return func(r *http.Request) string {
+		return prefixed(kind, r.Header.Get(name))
+	}
+}
+
+// Principal limits requests by the authenticated principal stored in the request context with WithPrincipal. Keys
+// are prefixed with "principal:".
+func Principal(r *http.Request) string {
+	return prefixed("principal", PrincipalFromContext(r.Context()))
+}
+
+// WithPrincipal returns a copy of the context with the authenticated principal. It should be called by the
+// authentication middleware placed before the rate limiting middleware.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFromContext returns the authenticated principal stored in the context or an empty string
+func PrincipalFromContext(ctx context.Context) string {
+	if principal, ok := ctx.Value(principalKey).(string); ok {
+		return principal
+	}
+
+	return ""
+}
+
+// FirstOf returns the first non-empty key of given key functions (eg. principal with a fallback to client IP)
+func FirstOf(keys ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		for _, k := range keys {
+			if key := k(r); len(key) > 0 {
+				return key
+			}
+		}
+
+		return ""
+	}
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/harnash/go-middlewares/realip"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeys(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.10:51234"
+	req.Header.Set("X-Api-Key", "secret")
+
+	assert.Equal(t, "ip:192.0.2.10", ClientIP(req), "invalid client IP")
+	assert.Equal(t, "header:X-Api-Key:secret", Header("x-api-key")(req), "invalid header key")
+	assert.Empty(t, Header("X-Missing")(req), "missing header should not be a key")
+	assert.Empty(t, Principal(req), "principal should be empty if not authenticated")
+	assert.Equal(t, "ip:192.0.2.10", FirstOf(Principal, ClientIP)(req), "fallback key not used")
+
+	req = req.WithContext(WithPrincipal(req.Context(), "alice"))
+	assert.Equal(t, "principal:alice", Principal(req), "invalid principal")
+	assert.Equal(t, "principal:alice", FirstOf(Principal, ClientIP)(req), "principal should be preferred")
+
+	// principal equal to the address of another client does not share its quota
+	req = req.WithContext(WithPrincipal(req.Context(), "192.0.2.10"))
+	assert.NotEqual(t, ClientIP(req), FirstOf(Principal, ClientIP)(req), "keys of different kinds should not collide")
+}
+
+func TestClientIPResolved(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:51234"
+	req.Header.Set(realip.ForwardedForHeader, "198.51.100.66, 192.0.2.10")
+
+	var key string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = ClientIP(r)
+	})
+	realip.Resolved(realip.WithTrustedProxies("10.0.0.0/8"))(handler).ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "ip:192.0.2.10", key, "resolved client IP should be preferred")
+}
@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Algorithm identifies the rate limiting algorithm of a Policy
+type Algorithm int
+
+const (
+	// TokenBucket allows bursts of up to Burst requests and refills tokens at Limit per Period rate
+	TokenBucket Algorithm = iota
+	// GCRA (generic cell rate algorithm) spaces requests evenly at Limit per Period rate allowing bursts of up to
+	// Burst requests. It behaves like a token bucket but needs a single timestamp of state.
+	GCRA
+	// SlidingWindow allows Limit requests in any Period long window. Counts of the current and the previous fixed
+	// windows are used to approximate the sliding window.
+	SlidingWindow
+)
+
+// String returns the name of the algorithm
+func (a Algorithm) String() string {
+	switch a {
+	case TokenBucket:
+		return "token_bucket"
+	case GCRA:
+		return "gcra"
+	case SlidingWindow:
+		return "sliding_window"
+	default:
+		return "unknown"
+	}
+}
+
+// Policy defines how many requests are allowed for a single key
+type Policy struct {
+	Algorithm Algorithm
+	// Limit is the number of requests allowed per Period
+	Limit  int
+	Period time.Duration
+	// Burst is the maximum number of requests allowed at once (TokenBucket and GCRA only). Limit is used if not set.
+	Burst int
+}
+
+// Result describes the decision of the rate limiter
+type Result struct {
+	Allowed bool
+	// Limit is the number of requests allowed per Period
+	Limit int
+	// Remaining is the number of requests that would be allowed right now
+	Remaining int
+	// ResetAfter is the time after which the quota is fully restored
+	ResetAfter time.Duration
+	// RetryAfter is the time after which the request would be allowed (only set if the request was denied)
+	RetryAfter time.Duration
+}
+
+// validate reports invalid policy
+func (p Policy) validate() error {
+	switch {
+	case p.Limit <= 0:
+		return errors.New("ratelimit: policy limit must be positive")
+	case p.Period <= 0:
+		return errors.New("ratelimit: policy period must be positive")
+	case p.Period/time.Duration(p.Limit) <= 0:
+		return errors.New("ratelimit: policy limit cannot exceed one request per nanosecond")
+	case p.Burst < 0:
+		return errors.New("ratelimit: policy burst cannot be negative")
+	case p.Algorithm < TokenBucket || p.Algorithm > SlidingWindow:
+		return errors.New("ratelimit: unknown policy algorithm")
+	}
+
+	return nil
+}
+
+// burst returns the maximum number of requests allowed at once
+func (p Policy) burst() int {
+	if p.Burst > 0 {
+		return p.Burst
+	}
+
+	return p.Limit
+}
+
+// state holds rate limiter state of a single key
+type state struct {
+	// tokens are available tokens (TokenBucket) or count of requests in the current window (SlidingWindow)
+	tokens float64
+	// previous is the count of requests in the previous window (SlidingWindow)
+	previous float64
+	// at is the time of the last refill (TokenBucket), theoretical arrival time (GCRA) or start of the current
+	// window (SlidingWindow)
+	at time.Time
+}
+
+// take tries to take a single request from the quota updating the state
+func (p Policy) take(s *state, now time.Time) Result {
+	switch p.Algorithm {
+	case GCRA:
+		return p.takeGCRA(s, now)
+	case SlidingWindow:
+		return p.takeSlidingWindow(s, now)
+	default:
+		return p.takeTokenBucket(s, now)
+	}
+}
+
+func (p Policy) takeTokenBucket(s *state, now time.Time) Result {
+	capacity := float64(p.burst())
+	interval := p.Period / time.Duration(p.Limit)
+
+	if s.at.IsZero() {
+		s.tokens = capacity
+	} else if elapsed := now.Sub(s.at); elapsed > 0 {
+		s.tokens = math.Min(capacity, s.tokens+float64(elapsed)/float64(interval))
+	}
+	s.at = now
+
+	result := Result{Limit: p.Limit}
+	if s.tokens >= 1 {
+		s.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - s.tokens) * float64(interval))
+	}
+	result.Remaining = int(s.tokens)
+	result.ResetAfter = time.Duration((capacity - s.tokens) * float64(interval))
+
+	return result
+}
+
+func (p Policy) takeGCRA(s *state, now time.Time) Result {
+	interval := p.Period / time.Duration(p.Limit)
+	tolerance := interval * time.Duration(p.burst())
+
+	tat := s.at
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(interval)
+
+	result := Result{Limit: p.Limit}
+	if allowAt := newTat.Add(-tolerance); now.Before(allowAt) {
+		result.RetryAfter = allowAt.Sub(now)
+		result.ResetAfter = tat.Sub(now)
+		return result
+	}
+
+	s.at = newTat
+	result.Allowed = true
+	result.Remaining = int((tolerance - newTat.Sub(now)) / interval)
+	result.ResetAfter = newTat.Sub(now)
+
+	return result
+}
+
+func (p Policy) takeSlidingWindow(s *state, now time.Time) Result {
+	// windows are aligned to the Unix epoch (like in the Redis store) and have no monotonic clock reading so they can
+	// be compared
+	start := time.Unix(0, now.UnixNano()-now.UnixNano()%int64(p.Period))
+	if !s.at.Equal(start) {
+		if s.at.Equal(start.Add(-p.Period)) {
+			s.previous = s.tokens
+		} else {
+			s.previous = 0
+		}
+		s.tokens = 0
+		s.at = start
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(p.Period)
+	limit := float64(p.Limit)
+	count := s.previous*weight + s.tokens
+
+	result := Result{Limit: p.Limit, ResetAfter: p.Period - elapsed}
+	if count+1 > limit {
+		switch {
+		case s.tokens+1 > limit:
+			// even without the previous window the request would be denied until the current window ends
+			result.RetryAfter = p.Period - elapsed
+		default:
+			// wait until the previous window weight drops enough
+			needed := 1 - (limit-1-s.tokens)/s.previous
+			result.RetryAfter = time.Duration(needed*float64(p.Period)) - elapsed
+		}
+		return result
+	}
+
+	s.tokens++
+	result.Allowed = true
+	result.Remaining = int(limit - count - 1)
+
+	return result
+}
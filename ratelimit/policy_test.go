@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyValidation(t *testing.T) {
+	assert.NoError(t, Policy{Limit: 10, Period: time.Second}.validate(), "valid policy reported")
+	assert.Error(t, Policy{Period: time.Second}.validate(), "missing limit not reported")
+	assert.Error(t, Policy{Limit: 10}.validate(), "missing period not reported")
+	assert.Error(t, Policy{Limit: 2_000_000_000, Period: time.Second}.validate(), "zero interval not reported")
+	assert.NoError(t, Policy{Limit: 1_000_000_000, Period: time.Second}.validate(), "one request per ns reported")
+	assert.Error(t, Policy{Limit: 10, Period: time.Second, Burst: -1}.validate(), "negative burst not reported")
+	assert.Error(t, Policy{Algorithm: 42, Limit: 10, Period: time.Second}.validate(), "unknown algorithm not reported")
+}
+
+func TestTokenBucket(t *testing.T) {
+	policy := Policy{Algorithm: TokenBucket, Limit: 10, Period: 10 * time.Second, Burst: 2}
+	now := time.Unix(1000, 0)
+	var s state
+
+	result := policy.take(&s, now)
+	assert.True(t, result.Allowed, "first request should be allowed")
+	assert.Equal(t, 1, result.Remaining, "invalid remaining requests")
+	assert.True(t, policy.take(&s, now).Allowed, "burst should be allowed")
+
+	result = policy.take(&s, now)
+	assert.False(t, result.Allowed, "request above burst should be denied")
+	assert.Equal(t, time.Second, result.RetryAfter, "invalid retry after")
+	assert.Equal(t, 2*time.Second, result.ResetAfter, "invalid reset after")
+
+	assert.True(t, policy.take(&s, now.Add(time.Second)).Allowed, "refilled token should be allowed")
+}
+
+func TestGCRA(t *testing.T) {
+	policy := Policy{Algorithm: GCRA, Limit: 10, Period: 10 * time.Second, Burst: 2}
+	now := time.Unix(1000, 0)
+	var s state
+
+	result := policy.take(&s, now)
+	assert.True(t, result.Allowed, "first request should be allowed")
+	assert.Equal(t, 1, result.Remaining, "invalid remaining requests")
+	result = policy.take(&s, now)
+	assert.True(t, result.Allowed, "burst should be allowed")
+	assert.Equal(t, 0, result.Remaining, "invalid remaining requests")
+
+	result = policy.take(&s, now)
+	assert.False(t, result.Allowed, "request above burst should be denied")
+	assert.Equal(t, time.Second, result.RetryAfter, "invalid retry after")
+	assert.Equal(t, 2*time.Second, result.ResetAfter, "invalid reset after")
+
+	assert.False(t, policy.take(&s, now.Add(500*time.Millisecond)).Allowed, "request should be denied until retry after")
+	assert.True(t, policy.take(&s, now.Add(time.Second)).Allowed, "request should be allowed after retry after")
+}
+
+func TestSlidingWindow(t *testing.T) {
+	policy := Policy{Algorithm: SlidingWindow, Limit: 4, Period: 10 * time.Second}
+	start := time.Unix(1000, 0)
+	var s state
+
+	for i := 0; i < 4; i++ {
+		assert.True(t, policy.take(&s, start.Add(5*time.Second)).Allowed, "requests within limit should be allowed")
+	}
+	result := policy.take(&s, start.Add(5*time.Second))
+	assert.False(t, result.Allowed, "request above limit should be denied")
+	assert.Equal(t, 5*time.Second, result.RetryAfter, "request should be denied until the window ends")
+
+	// half of the previous window counts: 4 * 0.5 = 2 requests
+	result = policy.take(&s, start.Add(15*time.Second))
+	assert.True(t, result.Allowed, "request should be allowed in the next window")
+	assert.Equal(t, 1, result.Remaining, "previous window not taken into account")
+	assert.True(t, policy.take(&s, start.Add(15*time.Second)).Allowed, "request within limit should be allowed")
+	result = policy.take(&s, start.Add(15*time.Second))
+	assert.False(t, result.Allowed, "previous window not taken into account")
+	assert.Equal(t, 2500*time.Millisecond, result.RetryAfter, "invalid retry after")
+
+	assert.True(t, policy.take(&s, start.Add(40*time.Second)).Allowed, "old windows should be forgotten")
+}
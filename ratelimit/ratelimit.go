@@ -0,0 +1,249 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/harnash/go-middlewares"
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Headers defined by the IETF RateLimit header fields draft
+const (
+	LimitHeader     = "RateLimit-Limit"
+	RemainingHeader = "RateLimit-Remaining"
+	ResetHeader     = "RateLimit-Reset"
+	PolicyHeader    = "RateLimit-Policy"
+)
+
+type options struct {
+	metrics Metrics
+	name    string
+	key     KeyFunc
+	denied  http.Handler
+	store   Store
+	failure FailurePolicy
+}
+
+// Option represents a rate limiter option.
+type Option func(*options)
+
+// WithMetrics sets custom metric collector/container for rate limiter metrics
+func WithMetrics(metrics Metrics) Option {
+	return func(o *options) {
+		o.metrics = metrics
+	}
+}
+
+// WithName sets the name of the limiter used in metrics ("default" by default)
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithKey sets the function returning the key the requests are limited by (ClientIP by default)
+func WithKey(key KeyFunc) Option {
+	return func(o *options) {
+		o.key = key
+	}
+}
+
+// WithDeniedHandler sets the handler responding to denied requests. Rate limit headers (including Retry-After) are
+// set before the handler is called. By default a plain text 429 response is sent.
+func WithDeniedHandler(handler http.Handler) Option {
+	return func(o *options) {
+		o.denied = handler
+	}
+}
+
+// FailurePolicy defines what happens with requests when the store returns an error
+type FailurePolicy int
+
+const (
+	// FailOpen allows requests when the store fails (default)
+	FailOpen FailurePolicy = iota
+	// FailClosed rejects requests with 503 response when the store fails
+	FailClosed
+)
+
+// WithStore sets the store keeping the rate limiter state (new MemoryStore by default). Limiters sharing the store
+// must have different names as the keys are prefixed with the limiter name.
+func WithStore(store Store) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithFailurePolicy sets what happens with requests when the store returns an error (FailOpen by default)
+func WithFailurePolicy(policy FailurePolicy) Option {
+	return func(o *options) {
+		o.failure = policy
+	}
+}
+
+// Metrics defines interface for custom metric collector/container
+type Metrics interface {
+	prometheus.Collector
+	GetRequests() *prometheus.CounterVec
+	GetStoreErrors() *prometheus.CounterVec
+}
+
+// defaultMetrics holds all the metrics of rate limiters
+type defaultMetrics struct {
+	requests    *prometheus.CounterVec
+	storeErrors *prometheus.CounterVec
+}
+
+var basicMetrics = newDefaultMetrics()
+
+// GetRequests return metric that counts allowed and denied requests per limiter
+func (s defaultMetrics) GetRequests() *prometheus.CounterVec {
+	return s.requests
+}
+
+// GetStoreErrors return metric that counts store errors per limiter
+func (s defaultMetrics) GetStoreErrors() *prometheus.CounterVec {
+	return s.storeErrors
+}
+
+// newDefaultMetrics creates new rate limiter metrics
+func newDefaultMetrics() Metrics {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_ratelimit_requests_total",
+		Help: "number of requests checked by the rate limiter per decision (allowed, denied)",
+	}, []string{"limiter", "decision"})
+
+	storeErrors := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_ratelimit_store_errors_total",
+		Help: "number of rate limiter store errors",
+	}, []string{"limiter"})
+
+	return defaultMetrics{requests: requests, storeErrors: storeErrors}
+}
+
+// Describe implements prometheus Collector interface.
+func (s defaultMetrics) Describe(in chan<- *prometheus.Desc) {
+	s.requests.Describe(in)
+	s.storeErrors.Describe(in)
+}
+
+// Collect implements prometheus Collector interface.
+func (s defaultMetrics) Collect(in chan<- prometheus.Metric) {
+	s.requests.Collect(in)
+	s.storeErrors.Collect(in)
+}
+
+// RegisterDefaultMetrics will register default rate limiter metrics instance in Prometheus. This is only needed if
+// any handlers are limited with default metrics (not overridden by WithMetrics() option)
+func RegisterDefaultMetrics(registerer prometheus.Registerer) error {
+	return registerer.Register(basicMetrics)
+}
+
+// UnregisterDefaultMetrics is a companion function to RegisterDefaultMetrics and must be called if RegisterDefaultMetrics
+// is used to cleanup the metrics in Prometheus
+func UnregisterDefaultMetrics(registerer prometheus.Registerer) {
+	registerer.Unregister(basicMetrics)
+}
+
+// newOptions takes functional options and returns options.
+func newOptions(opts ...Option) *options {
+	cfg := &options{
+		metrics: basicMetrics,
+		name:    "default",
+		key:     ClientIP,
+		denied:  http.HandlerFunc(tooManyRequests),
+	}
+
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	if cfg.store == nil {
+		cfg.store = NewMemoryStore(DefaultShards)
+	}
+
+	return cfg
+}
+
+// tooManyRequests is the default handler of denied requests
+func tooManyRequests(w http.ResponseWriter, _ *http.Request) {
+	http.Error(w, "429 - Too Many Requests", http.StatusTooManyRequests)
+}
+
+// Limited will limit the rate of requests per key (client IP by default) according to the policy. All handlers wrapped
+// by the returned middleware share the quota. Responses carry the RateLimit-* headers and denied requests get 429
+// response with the Retry-After header. Limited panics if the policy is invalid or not supported by the store.
+func Limited(policy Policy, options ...Option) middlewares.Middleware {
+	if err := policy.validate(); err != nil {
+		panic(err)
+	}
+
+	o := newOptions(options...)
+	if v, ok := o.store.(policyValidator); ok {
+		if err := v.validatePolicy(policy); err != nil {
+			panic(err)
+		}
+	}
+	prefix := o.name + ":"
+	allowed := o.metrics.GetRequests().WithLabelValues(o.name, "allowed")
+	denied := o.metrics.GetRequests().WithLabelValues(o.name, "denied")
+	storeErrors := o.metrics.GetStoreErrors().WithLabelValues(o.name)
+	policyHeader := fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Period))
+
+	fn := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := o.key(r)
+			if len(key) == 0 {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := o.store.Take(r.Context(), prefix+key, policy, time.Now())
+			if err != nil {
+				storeErrors.Inc()
+				if logger := logging.FromRequest(r); logger != nil {
+					logger.With("ratelimit_limiter", o.name, "err", err).Error("rate limiter store failed")
+				}
+				if o.failure == FailClosed {
+					http.Error(w, "503 - Service Unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set(LimitHeader, strconv.Itoa(result.Limit))
+			header.Set(RemainingHeader, strconv.Itoa(result.Remaining))
+			header.Set(ResetHeader, strconv.FormatInt(ceilSeconds(result.ResetAfter), 10))
+			header.Set(PolicyHeader, policyHeader)
+
+			if !result.Allowed {
+				denied.Inc()
+				retryAfter := max(ceilSeconds(result.RetryAfter), 1)
+				header.Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+				if logger := logging.FromRequest(r); logger != nil {
+					logger.With("ratelimit_limiter", o.name, "ratelimit_key", key, "retry_after_s", retryAfter).
+						Info("rate limit exceeded")
+				}
+				o.denied.ServeHTTP(w, r)
+				return
+			}
+
+			allowed.Inc()
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	return fn
+}
+
+// ceilSeconds rounds the duration up to whole seconds
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestLimited(t *testing.T) {
+	err := RegisterDefaultMetrics(prometheus.DefaultRegisterer)
+	assert.NoError(t, err, "error while registering rate limiter metrics")
+	defer UnregisterDefaultMetrics(prometheus.DefaultRegisterer)
+
+	logWatcher, logs := observer.New(zapcore.DebugLevel)
+	customLog := logging.LogGetter(func() (*zap.SugaredLogger, error) {
+		return zap.New(logWatcher).Sugar(), nil
+	})
+
+	policy := Policy{Algorithm: GCRA, Limit: 2, Period: time.Minute}
+	handler := logging.InContext(logging.WithLogger(customLog))(Limited(policy, WithKey(Header("X-Api-Key")))(okHandler))
+
+	request := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Api-Key", apiKey)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request("alice")
+	assert.Equal(t, http.StatusOK, rec.Code, "request within limit should be allowed")
+	assert.Equal(t, "2", rec.Header().Get(LimitHeader), "invalid limit header")
+	assert.Equal(t, "1", rec.Header().Get(RemainingHeader), "invalid remaining header")
+	assert.Equal(t, "30", rec.Header().Get(ResetHeader), "invalid reset header")
+	assert.Equal(t, "2;w=60", rec.Header().Get(PolicyHeader), "invalid policy header")
+	assert.Empty(t, rec.Header().Get("Retry-After"), "retry after set for allowed request")
+
+	assert.Equal(t, http.StatusOK, request("alice").Code, "request within limit should be allowed")
+	rec = request("alice")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "request above limit should be denied")
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"), "invalid retry after header")
+	assert.Equal(t, "0", rec.Header().Get(RemainingHeader), "invalid remaining header")
+
+	assert.Equal(t, http.StatusOK, request("bob").Code, "keys should be limited separately")
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, request("").Code, "requests without key should not be limited")
+	}
+
+	if assert.Equal(t, 1, logs.Len(), "denied request not logged") {
+		entry := logs.TakeAll()[0]
+		assert.Equal(t, "rate limit exceeded", entry.Message, "invalid log message")
+		assert.Equal(t, "header:X-Api-Key:alice", entry.ContextMap()["ratelimit_key"], "key not logged")
+	}
+
+	assert.HTTPBodyContains(t, promhttp.Handler().ServeHTTP, "GET", "/", url.Values{}, `http_ratelimit_requests_total{decision="allowed",limiter="default"} 3`, "allowed requests not counted")
+	assert.HTTPBodyContains(t, promhttp.Handler().ServeHTTP, "GET", "/", url.Values{}, `http_ratelimit_requests_total{decision="denied",limiter="default"} 1`, "denied requests not counted")
+}
+
+func TestLimitedDeniedHandler(t *testing.T) {
+	denied := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	handler := Limited(Policy{Algorithm: SlidingWindow, Limit: 1, Period: time.Hour}, WithDeniedHandler(denied))(okHandler)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "first request should be allowed")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "custom denied handler not used")
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"), "headers should be set before the denied handler")
+}
+
+func TestLimitedInvalidPolicy(t *testing.T) {
+	assert.Panics(t, func() { Limited(Policy{Limit: 1}) }, "invalid policy should panic")
+}
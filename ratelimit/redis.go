@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript implements all the algorithms of Policy.take atomically. Times are in microseconds since the Unix epoch.
+//
+// KEYS[1] - key of the hash with the state (fields: tokens, previous, at)
+// ARGV    - algorithm, limit, period, burst, now
+// returns - {allowed, remaining, reset after, retry after}
+var takeScript = redis.NewScript(`
+local key = KEYS[1]
+local algorithm = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+local burst = tonumber(ARGV[4])
+local now = tonumber(ARGV[5])
+
+local state = redis.call('HMGET', key, 'tokens', 'previous', 'at')
+local tokens = tonumber(state[1])
+local previous = tonumber(state[2]) or 0
+local at = tonumber(state[3])
+local interval = period / limit
+local allowed, remaining, reset, retry = 0, 0, 0, 0
+
+if algorithm == 1 then
+	-- GCRA
+	local tolerance = interval * burst
+	local tat = at or now
+	if tat < now then
+		tat = now
+	end
+	local newTat = tat + interval
+	local allowAt = newTat - tolerance
+	if now < allowAt then
+		retry = allowAt - now
+		reset = tat - now
+	else
+		allowed = 1
+		at = newTat
+		remaining = math.floor((tolerance - (newTat - now)) / interval)
+		reset = newTat - now
+	end
+elseif algorithm == 2 then
+	-- sliding window
+	local start = now - (now % period)
+	if at ~= start then
+		if at == start - period then
+			previous = tokens or 0
+		else
+			previous = 0
+		end
+		tokens = 0
+		at = start
+	end
+	local elapsed = now - start
+	local count = previous * (1 - elapsed / period) + tokens
+	reset = period - elapsed
+	if count + 1 > limit then
+		if tokens + 1 > limit then
+			retry = period - elapsed
+		else
+			retry = (1 - (limit - 1 - tokens) / previous) * period - elapsed
+		end
+	else
+		allowed = 1
+		tokens = tokens + 1
+		remaining = math.floor(limit - count - 1)
+	end
+else
+	-- token bucket
+	if at == nil then
+		tokens = burst
+	elseif now > at then
+		tokens = math.min(burst, tokens + (now - at) / interval)
+	end
+	at = now
+	if tokens >= 1 then
+		allowed = 1
+		tokens = tokens - 1
+	else
+		retry = (1 - tokens) * interval
+	end
+	remaining = math.floor(tokens)
+	reset = (burst - tokens) * interval
+end
+
+if at ~= nil then
+	-- tostring would lose precision of the timestamps
+	redis.call('HSET', key, 'tokens', string.format('%.17g', tokens or 0), 'previous', string.format('%.17g', previous),
+		'at', string.format('%.17g', at))
+	redis.call('PEXPIRE', key, math.ceil((reset + period) / 1000))
+end
+
+return {allowed, remaining, math.ceil(reset), math.ceil(retry)}
+`)
+
+// RedisStore keeps the state of all the keys in Redis (or any server compatible with Redis scripting) so the limits
+// are shared by all replicas of the service. Every Take is a single atomic Lua script call. Replicas should have
+// synchronized clocks as the time of the request is passed to the script.
+type RedisStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+// RedisOption represents a RedisStore option.
+type RedisOption func(*RedisStore)
+
+// WithPrefix sets the prefix of the keys stored in Redis ("ratelimit:" by default)
+func WithPrefix(prefix string) RedisOption {
+	return func(s *RedisStore) {
+		s.prefix = prefix
+	}
+}
+
+// NewRedisStore creates new RedisStore using a given client (eg. *redis.Client, *redis.ClusterClient)
+func NewRedisStore(client redis.Scripter, options ...RedisOption) *RedisStore {
+	store := &RedisStore{client: client, prefix: "ratelimit:"}
+	for _, o := range options {
+		o(store)
+	}
+
+	return store
+}
+
+// validatePolicy reports the policy with the period shorter than a microsecond as the times are sent to Redis in
+// microseconds
+func (s *RedisStore) validatePolicy(policy Policy) error {
+	if policy.Period < time.Microsecond {
+		return errors.New("ratelimit: policy period must be at least one microsecond for RedisStore")
+	}
+
+	return nil
+}
+
+// Take implements Store interface. Policies with the period shorter than a microsecond are not supported.
+func (s *RedisStore) Take(ctx context.Context, key string, policy Policy, now time.Time) (Result, error) {
+	if err := s.validatePolicy(policy); err != nil {
+		return Result{}, err
+	}
+	values, err := takeScript.Run(ctx, s.client, []string{s.prefix + key}, int(policy.Algorithm), policy.Limit,
+		policy.Period.Microseconds(), policy.burst(), now.UnixMicro()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      policy.Limit,
+		Remaining:  int(values[1]),
+		ResetAfter: time.Duration(values[2]) * time.Microsecond,
+		RetryAfter: time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisStoreMatchesMemoryStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	policies := map[string]Policy{
+		"token_bucket":   {Algorithm: TokenBucket, Limit: 10, Period: 10 * time.Second, Burst: 3},
+		"gcra":           {Algorithm: GCRA, Limit: 10, Period: 10 * time.Second, Burst: 3},
+		"sliding_window": {Algorithm: SlidingWindow, Limit: 5, Period: 10 * time.Second},
+	}
+	offsets := []time.Duration{0, 0, 0, 0, 0, 500 * time.Millisecond, time.Second, 1500 * time.Millisecond,
+		12 * time.Second, 12 * time.Second, 12 * time.Second, 13 * time.Second, 35 * time.Second}
+
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			redisStore := NewRedisStore(client)
+			memoryStore := NewMemoryStore(1)
+			start := time.UnixMicro(1700000000000000)
+
+			for i, offset := range offsets {
+				now := start.Add(offset)
+				expected, err := memoryStore.Take(context.Background(), name, policy, now)
+				assert.NoError(t, err, "memory store failed")
+				result, err := redisStore.Take(context.Background(), name, policy, now)
+				if assert.NoError(t, err, "redis store failed") {
+					assert.Equal(t, expected.Allowed, result.Allowed, "invalid decision of request %d", i)
+					assert.Equal(t, expected.Remaining, result.Remaining, "invalid remaining requests of request %d", i)
+					assert.InDelta(t, expected.ResetAfter, result.ResetAfter, float64(time.Microsecond), "invalid reset after of request %d", i)
+					assert.InDelta(t, expected.RetryAfter, result.RetryAfter, float64(time.Microsecond), "invalid retry after of request %d", i)
+				}
+			}
+
+			assert.True(t, server.Exists("ratelimit:"+name), "state not stored with prefix")
+			assert.True(t, server.TTL("ratelimit:"+name) > 0, "state stored without expiration")
+		})
+	}
+}
+
+func TestRedisStoreFailurePolicy(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	defer client.Close()
+	server.SetError("server is down")
+
+	policy := Policy{Limit: 1, Period: time.Minute}
+	for failure, status := range map[FailurePolicy]int{FailOpen: http.StatusOK, FailClosed: http.StatusServiceUnavailable} {
+		metrics := newDefaultMetrics()
+		handler := Limited(policy, WithStore(NewRedisStore(client)), WithFailurePolicy(failure), WithMetrics(metrics))(okHandler)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, status, rec.Code, "failure policy not applied")
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.GetStoreErrors().WithLabelValues("default")), "store error not counted")
+	}
+}
+
+func TestRedisStoreSmallPeriods(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	store := NewRedisStore(client)
+
+	tooShort := Policy{Limit: 1, Period: 500 * time.Nanosecond}
+	_, err := store.Take(context.Background(), "too_short", tooShort, time.Now())
+	assert.Error(t, err, "period shorter than a microsecond should not be accepted")
+	assert.Panics(t, func() { Limited(tooShort, WithStore(store)) }, "period shorter than a microsecond should panic")
+	assert.NotPanics(t, func() { Limited(tooShort) }, "memory store should accept short periods")
+
+	for _, algorithm := range []Algorithm{TokenBucket, GCRA, SlidingWindow} {
+		for _, period := range []time.Duration{time.Microsecond, 100 * time.Microsecond} {
+			key := algorithm.String() + ":" + period.String()
+			policy := Policy{Algorithm: algorithm, Limit: 1, Period: period}
+			now := time.UnixMicro(1700000000000000)
+			result, err := store.Take(context.Background(), key, policy, now)
+			if assert.NoError(t, err, "%s failed", key) {
+				assert.True(t, result.Allowed, "first request should be allowed by %s", key)
+			}
+			result, err = store.Take(context.Background(), key, policy, now)
+			if assert.NoError(t, err, "%s failed", key) {
+				assert.False(t, result.Allowed, "second request should be denied by %s", key)
+				assert.LessOrEqual(t, result.RetryAfter, period, "invalid retry after of %s", key)
+			}
+			assert.True(t, server.TTL("ratelimit:"+key) > 0, "state of %s stored without expiration", key)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// DefaultShards is the number of shards of the MemoryStore created by Limited if no store is set
+const DefaultShards = 32
+
+// Store keeps the rate limiter state of all the keys. Store can be shared by multiple limiters as long as they have
+// different names (see: WithName).
+type Store interface {
+	// Take tries to take a single request from the quota of a given key according to the policy
+	Take(ctx context.Context, key string, policy Policy, now time.Time) (Result, error)
+}
+
+// policyValidator is implemented by stores that cannot enforce all the valid policies
+type policyValidator interface {
+	// validatePolicy reports the policy the store cannot enforce
+	validatePolicy(policy Policy) error
+}
+
+// MemoryStore keeps the state of all the keys in memory of a single process. Keys are split into shards with separate
+// locks to reduce contention. Keys with fully restored quota are forgotten.
+type MemoryStore struct {
+	shards []*memoryShard
+}
+
+// NewMemoryStore creates new MemoryStore with a given number of shards
+func NewMemoryStore(shards int) *MemoryStore {
+	if shards < 1 {
+		shards = 1
+	}
+
+	store := &MemoryStore{shards: make([]*memoryShard, shards)}
+	for i := range store.shards {
+		store.shards[i] = &memoryShard{entries: map[string]*entry{}}
+	}
+
+	return store
+}
+
+// Take implements Store interface
+func (s *MemoryStore) Take(_ context.Context, key string, policy Policy, now time.Time) (Result, error) {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+
+	return s.shards[hash.Sum32()%uint32(len(s.shards))].take(key, policy, now), nil
+}
+
+// memoryShard keeps rate limiter state of a part of the keys
+type memoryShard struct {
+	lock      sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+// entry is the state of a single key with the time after which it can be forgotten
+type entry struct {
+	state
+	expires time.Time
+}
+
+// take applies the policy to the state of a given key
+func (s *memoryShard) take(key string, policy Policy, now time.Time) Result {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.sweep(policy, now)
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry{}
+		s.entries[key] = e
+	}
+
+	result := policy.take(&e.state, now)
+	// sliding window state is needed for one more period as the previous window count
+	e.expires = now.Add(result.ResetAfter + policy.Period)
+
+	return result
+}
+
+// sweep forgets the keys with fully restored quota, at most once per policy period
+func (s *memoryShard) sweep(policy Policy, now time.Time) {
+	if now.Sub(s.lastSweep) < policy.Period {
+		return
+	}
+
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
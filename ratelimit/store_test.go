@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreSweep(t *testing.T) {
+	policy := Policy{Limit: 1, Period: time.Second}
+	store := NewMemoryStore(1)
+	shard := store.shards[0]
+	now := time.Unix(1000, 0)
+
+	_, _ = store.Take(context.Background(), "alice", policy, now)
+	_, _ = store.Take(context.Background(), "bob", policy, now.Add(2*time.Second))
+	assert.Len(t, shard.entries, 2, "keys forgotten too early")
+	_, _ = store.Take(context.Background(), "bob", policy, now.Add(5*time.Second))
+	assert.Len(t, shard.entries, 1, "keys with restored quota not forgotten")
+}
+
+func TestMemoryStoreConcurrency(t *testing.T) {
+	policy := Policy{Algorithm: GCRA, Limit: 100, Period: time.Hour}
+	store := NewMemoryStore(DefaultShards)
+	now := time.Unix(1000, 0)
+
+	var lock sync.Mutex
+	allowed := map[string]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, key := range []string{"alice", "bob", "carol"} {
+				for j := 0; j < 20; j++ {
+					result, err := store.Take(context.Background(), key, policy, now)
+					assert.NoError(t, err, "memory store should not fail")
+					if result.Allowed {
+						lock.Lock()
+						allowed[key]++
+						lock.Unlock()
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, map[string]int{"alice": 100, "bob": 100, "carol": 100}, allowed, "quota not enforced")
+}
@@ -0,0 +1,90 @@
+package realip
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// normalize returns the address comparable with the trusted networks
+func normalize(addr netip.Addr) netip.Addr {
+	return addr.Unmap().WithZone("")
+}
+
+// parseAddr parses the address of the node as sent by the proxies: plain IPv4 or IPv6 address, optionally with the
+// port, quoted and with the IPv6 address in square brackets (eg. "[2001:db8::17]:4711")
+func parseAddr(node string) (netip.Addr, bool) {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if addr, err := netip.ParseAddr(node); err == nil {
+		return normalize(addr), true
+	}
+	if addrPort, err := netip.ParseAddrPort(node); err == nil {
+		return normalize(addrPort.Addr()), true
+	}
+	if strings.HasPrefix(node, "[") && strings.HasSuffix(node, "]") {
+		if addr, err := netip.ParseAddr(node[1 : len(node)-1]); err == nil {
+			return normalize(addr), true
+		}
+	}
+
+	return netip.Addr{}, false
+}
+
+// splitQuoted splits the value by the separator placed outside of the quoted strings
+func splitQuoted(value string, separator byte) []string {
+	var parts []string
+	quoted, escaped, start := false, false, 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && value[i] == '\\':
+			escaped = true
+		case value[i] == '"':
+			quoted = !quoted
+		case !quoted && value[i] == separator:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, value[start:])
+}
+
+// forwardedFor returns the "for" parameters of all the elements of the RFC 7239 Forwarded header values in order.
+// Elements without the parameter are returned as empty strings so they are not mistaken for the next hop.
+func forwardedFor(values []string) []string {
+	var nodes []string
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			if len(strings.TrimSpace(element)) == 0 {
+				continue
+			}
+
+			var node string
+			for _, pair := range splitQuoted(element, ';') {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					node = value
+					break
+				}
+			}
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes
+}
+
+// forwardedList returns the addresses of the comma separated header values (eg. X-Forwarded-For) in order
+func forwardedList(values []string) []string {
+	var nodes []string
+	for _, value := range values {
+		for _, node := range strings.Split(value, ",") {
+			if node = strings.TrimSpace(node); len(node) > 0 {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+
+	return nodes
+}
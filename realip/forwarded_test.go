@@ -0,0 +1,50 @@
+package realip
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAddr(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.60":                 "192.0.2.60",
+		" 192.0.2.60 ":               "192.0.2.60",
+		"192.0.2.60:4711":            "192.0.2.60",
+		`"192.0.2.60:4711"`:          "192.0.2.60",
+		"2001:db8:cafe::17":          "2001:db8:cafe::17",
+		"[2001:db8:cafe::17]":        "2001:db8:cafe::17",
+		`"[2001:db8:cafe::17]:4711"`: "2001:db8:cafe::17",
+		"::ffff:192.0.2.60":          "192.0.2.60",
+		"fe80::1%eth0":               "fe80::1",
+	}
+	for node, expected := range tests {
+		addr, ok := parseAddr(node)
+		if assert.True(t, ok, "could not parse %s", node) {
+			assert.Equal(t, netip.MustParseAddr(expected), addr, "invalid address of %s", node)
+		}
+	}
+
+	for _, node := range []string{"", "unknown", "_hidden", "example.com", "192.0.2.300"} {
+		_, ok := parseAddr(node)
+		assert.False(t, ok, "%s should not be parsed", node)
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	nodes := forwardedFor([]string{
+		`for=192.0.2.43, For="[2001:db8:cafe::17]:4711";proto=https`,
+		`proto=http;by=203.0.113.43, for=198.51.100.17;by="a,b;c"`,
+		`for=unknown`,
+	})
+	assert.Equal(t, []string{"192.0.2.43", `"[2001:db8:cafe::17]:4711"`, "", "198.51.100.17", "unknown"}, nodes,
+		"invalid nodes")
+
+	assert.Equal(t, []string{`"a\",b"`, "c"}, splitQuoted(`"a\",b",c`, ','), "invalid split of quoted strings")
+}
+
+func TestForwardedList(t *testing.T) {
+	nodes := forwardedList([]string{"203.0.113.195, 70.41.3.18", " 150.172.238.178 ,,", ""})
+	assert.Equal(t, []string{"203.0.113.195", "70.41.3.18", "150.172.238.178"}, nodes, "invalid nodes")
+}
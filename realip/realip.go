@@ -0,0 +1,197 @@
+package realip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/harnash/go-middlewares"
+)
+
+type key int
+
+const clientIPKey key = 651
+
+// Headers carrying the addresses of the client and the proxies
+const (
+	ForwardedHeader    = "Forwarded"
+	ForwardedForHeader = "X-Forwarded-For"
+	RealIPHeader       = "X-Real-IP"
+)
+
+// DefaultHeader is the header the client address is taken from by default
+const DefaultHeader = ForwardedForHeader
+
+// PrivateNetworks are the loopback, private and link-local networks, eg. to trust all the proxies in the cluster
+var PrivateNetworks = []string{
+	"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16",
+	"::1/128", "fc00::/7", "fe80::/10",
+}
+
+type options struct {
+	trusted []netip.Prefix
+	header  string
+}
+
+// Option represents a client IP resolution option.
+type Option func(*options)
+
+// WithTrustedProxies sets the networks (eg. "10.0.0.0/8") or addresses of the proxies whose headers are trusted. No
+// proxies are trusted by default so the address of the connection is used. Panics if any of them is invalid.
+func WithTrustedProxies(proxies ...string) Option {
+	return func(o *options) {
+		o.trusted = nil
+		for _, proxy := range proxies {
+			o.trusted = append(o.trusted, parsePrefix(proxy))
+		}
+	}
+}
+
+// WithHeader sets the header the client address is taken from (DefaultHeader by default). It must be the header the
+// trusted proxies actually write: any other header is sent by the client as is and would let it forge its address.
+// Headers other than Forwarded are expected to hold comma separated addresses.
+func WithHeader(header string) Option {
+	return func(o *options) {
+		o.header = header
+	}
+}
+
+// newOptions takes functional options and returns options.
+func newOptions(opts ...Option) *options {
+	cfg := &options{header: DefaultHeader}
+
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	return cfg
+}
+
+// parsePrefix parses the network or the address of the trusted proxy
+func parsePrefix(proxy string) netip.Prefix {
+	proxy = strings.TrimSpace(proxy)
+	if !strings.Contains(proxy, "/") {
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			panic(fmt.Sprintf("invalid trusted proxy %q: %v", proxy, err))
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	prefix, err := netip.ParsePrefix(proxy)
+	if err != nil {
+		panic(fmt.Sprintf("invalid trusted proxy %q: %v", proxy, err))
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked()
+}
+
+// isTrusted reports if the address belongs to the trusted proxy
+func (o *options) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range o.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodes returns the addresses sent in the header in order from the client to the last proxy
+func nodes(r *http.Request, header string) []string {
+	values := r.Header.Values(header)
+	if http.CanonicalHeaderKey(header) == ForwardedHeader {
+		return forwardedFor(values)
+	}
+	return forwardedList(values)
+}
+
+// resolve returns the rightmost untrusted address of the nodes appended to the remote address. If all the nodes are
+// trusted the leftmost one is returned. Nodes left of the invalid (eg. "unknown" or obfuscated) one cannot be
+// trusted so the node right of it is returned.
+func (o *options) resolve(remote netip.Addr, nodes []string) netip.Addr {
+	client := remote
+	for i := len(nodes) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(nodes[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !o.isTrusted(addr) {
+			break
+		}
+	}
+
+	return client
+}
+
+// remoteAddr returns the address of the client connection
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return parseAddr(host)
+}
+
+// Resolved is a middleware that will resolve the address of the client and store it in the request's context (see:
+// FromRequest). The header written by the proxies (see: WithHeader) is honoured only if the connection comes from the
+// trusted proxy, the chain of the addresses is then walked from the right and the first address not belonging to the
+// trusted proxy is picked as the client cannot forge the addresses appended by the proxies.
+func Resolved(options ...Option) middlewares.Middleware {
+	o := newOptions(options...)
+
+	fn := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remote, ok := remoteAddr(r)
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			client := remote
+			if o.isTrusted(remote) {
+				client = o.resolve(remote, nodes(r, o.header))
+			}
+
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey, client)))
+		})
+	}
+
+	return fn
+}
+
+// FromContext returns the client address resolved by the middleware and true, or false if it was not resolved
+func FromContext(ctx context.Context) (netip.Addr, bool) {
+	addr, ok := ctx.Value(clientIPKey).(netip.Addr)
+	return addr, ok
+}
+
+// FromRequest returns the client address resolved by the middleware or the address of the connection if it was not
+// resolved. The returned address is invalid if neither is known.
+func FromRequest(r *http.Request) netip.Addr {
+	if addr, ok := FromContext(r.Context()); ok {
+		return addr
+	}
+	addr, _ := remoteAddr(r)
+	return addr
+}
+
+// ClientIP returns the client address as a string (see: FromRequest) falling back to the host of the connection
+// address if it cannot be parsed
+func ClientIP(r *http.Request) string {
+	if addr := FromRequest(r); addr.IsValid() {
+		return addr.String()
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
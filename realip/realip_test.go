@@ -0,0 +1,155 @@
+package realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolved(t *testing.T) {
+	tests := map[string]struct {
+		header   string
+		remote   string
+		headers  map[string][]string
+		expected string
+	}{
+		"untrusted connection": {
+			remote:   "198.51.100.7:4711",
+			headers:  map[string][]string{ForwardedForHeader: {"203.0.113.1"}},
+			expected: "198.51.100.7",
+		},
+		"no headers": {
+			remote:   "10.0.0.1:4711",
+			expected: "10.0.0.1",
+		},
+		"rightmost untrusted": {
+			remote:   "10.0.0.1:4711",
+			headers:  map[string][]string{ForwardedForHeader: {"198.51.100.66, 203.0.113.1", "10.0.0.2"}},
+			expected: "203.0.113.1",
+		},
+		"all trusted": {
+			remote:   "10.0.0.1:4711",
+			headers:  map[string][]string{ForwardedForHeader: {"10.1.0.1, 10.0.0.2"}},
+			expected: "10.1.0.1",
+		},
+		"invalid node": {
+			remote:   "10.0.0.1:4711",
+			headers:  map[string][]string{ForwardedForHeader: {"198.51.100.66, garbage, 10.0.0.2"}},
+			expected: "10.0.0.2",
+		},
+		"forged forwarded": {
+			remote: "10.0.0.1:4711",
+			headers: map[string][]string{
+				ForwardedHeader:    {"for=6.6.6.6"},
+				ForwardedForHeader: {"6.6.6.6, 203.0.113.7"},
+			},
+			expected: "203.0.113.7",
+		},
+		"forwarded": {
+			header: ForwardedHeader,
+			remote: "10.0.0.1:4711",
+			headers: map[string][]string{
+				ForwardedHeader:    {`for=198.51.100.66, for="[2001:db8::17]:4711";proto=https, for=10.0.0.2`},
+				ForwardedForHeader: {"203.0.113.1"},
+			},
+			expected: "2001:db8::17",
+		},
+		"forwarded unknown": {
+			header:   ForwardedHeader,
+			remote:   "10.0.0.1:4711",
+			headers:  map[string][]string{ForwardedHeader: {"for=198.51.100.66, for=unknown"}},
+			expected: "10.0.0.1",
+		},
+		"forged forwarded for": {
+			header: ForwardedHeader,
+			remote: "10.0.0.1:4711",
+			headers: map[string][]string{
+				ForwardedHeader:    {"for=203.0.113.7"},
+				ForwardedForHeader: {"6.6.6.6"},
+			},
+			expected: "203.0.113.7",
+		},
+		"missing configured header": {
+			header:   RealIPHeader,
+			remote:   "10.0.0.1:4711",
+			headers:  map[string][]string{ForwardedForHeader: {"6.6.6.6"}},
+			expected: "10.0.0.1",
+		},
+		"real ip": {
+			header:   RealIPHeader,
+			remote:   "[fd00::1]:4711",
+			headers:  map[string][]string{RealIPHeader: {"203.0.113.1"}},
+			expected: "203.0.113.1",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			options := []Option{WithTrustedProxies("10.0.0.0/16", "fd00::1")}
+			if len(test.header) > 0 {
+				options = append(options, WithHeader(test.header))
+			}
+			var resolved netip.Addr
+			handler := Resolved(options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				resolved, _ = FromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remote
+			for header, values := range test.headers {
+				for _, value := range values {
+					r.Header.Add(header, value)
+				}
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			assert.Equal(t, netip.MustParseAddr(test.expected), resolved, "invalid client address")
+		})
+	}
+}
+
+func TestResolvedHeader(t *testing.T) {
+	var client string
+	handler := Resolved(WithTrustedProxies(PrivateNetworks...), WithHeader("CF-Connecting-IP"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client = ClientIP(r)
+		}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.168.1.10:4711"
+	r.Header.Set(ForwardedForHeader, "198.51.100.66")
+	r.Header.Set("Cf-Connecting-Ip", "203.0.113.1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "203.0.113.1", client, "only configured header should be used")
+}
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.10:51234"
+	_, ok := FromContext(r.Context())
+	assert.False(t, ok, "address should not be resolved without the middleware")
+	assert.Equal(t, netip.MustParseAddr("192.0.2.10"), FromRequest(r), "connection address should be used")
+	assert.Equal(t, "192.0.2.10", ClientIP(r), "invalid client IP")
+
+	r.RemoteAddr = "@"
+	assert.False(t, FromRequest(r).IsValid(), "address should not be known")
+	assert.Equal(t, "@", ClientIP(r), "connection address should be used as is")
+
+	var reached bool
+	Resolved()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	assert.True(t, reached, "request with unknown address should be passed through")
+}
+
+func TestParsePrefix(t *testing.T) {
+	assert.Equal(t, netip.MustParsePrefix("10.0.0.0/8"), parsePrefix("10.1.2.3/8"), "prefix should be masked")
+	assert.Equal(t, netip.MustParsePrefix("192.0.2.1/32"), parsePrefix("192.0.2.1"), "invalid address prefix")
+	assert.Equal(t, netip.MustParsePrefix("2001:db8::1/128"), parsePrefix("2001:db8::1"), "invalid address prefix")
+	assert.Equal(t, netip.MustParsePrefix("192.0.2.0/24"), parsePrefix("::ffff:192.0.2.0/120"),
+		"IPv4-mapped prefix should be unmapped")
+	assert.Panics(t, func() { parsePrefix("10.0.0.0/33") }, "invalid prefix should not be accepted")
+	assert.Panics(t, func() { WithTrustedProxies("proxy.local")(newOptions()) }, "invalid address should not be accepted")
+}
@@ -0,0 +1,177 @@
+package secure
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type key int
+
+const nonceKey key = 571
+
+// Content Security Policy directives
+const (
+	DefaultSrc              = "default-src"
+	ScriptSrc               = "script-src"
+	StyleSrc                = "style-src"
+	ImgSrc                  = "img-src"
+	ConnectSrc              = "connect-src"
+	FontSrc                 = "font-src"
+	ObjectSrc               = "object-src"
+	MediaSrc                = "media-src"
+	FrameSrc                = "frame-src"
+	WorkerSrc               = "worker-src"
+	ManifestSrc             = "manifest-src"
+	BaseURI                 = "base-uri"
+	FormAction              = "form-action"
+	FrameAncestors          = "frame-ancestors"
+	UpgradeInsecureRequests = "upgrade-insecure-requests"
+)
+
+// Content Security Policy sources
+const (
+	Self          = "'self'"
+	None          = "'none'"
+	UnsafeInline  = "'unsafe-inline'"
+	UnsafeEval    = "'unsafe-eval'"
+	StrictDynamic = "'strict-dynamic'"
+	// NonceSource is replaced with the nonce generated for the request, eg. "'nonce-3q2+7w=='"
+	NonceSource = "'nonce'"
+)
+
+// reportingGroup is the name of the Reporting API endpoint the CSP violations are sent to
+const reportingGroup = "csp-endpoint"
+
+// directive holds the CSP directive with its sources
+type directive struct {
+	name    string
+	sources []string
+}
+
+// CSP builds the Content-Security-Policy header, eg.:
+//
+//	secure.NewCSP().
+//		Add(secure.DefaultSrc, secure.Self).
+//		Add(secure.ScriptSrc, secure.NonceSource, secure.StrictDynamic).
+//		Add(secure.ObjectSrc, secure.None).
+//		ReportTo("/csp-report")
+type CSP struct {
+	directives []directive
+	reportURI  string
+}
+
+// NewCSP returns an empty Content Security Policy
+func NewCSP() *CSP {
+	return &CSP{}
+}
+
+// Add adds the sources to the directive. Directives keep the order in which they were added first.
+func (c *CSP) Add(name string, sources ...string) *CSP {
+	name = strings.ToLower(name)
+	for i := range c.directives {
+		if c.directives[i].name == name {
+			c.directives[i].sources = append(c.directives[i].sources, sources...)
+			return c
+		}
+	}
+	c.directives = append(c.directives, directive{name: name, sources: sources})
+	return c
+}
+
+// ReportTo sets the URI the violations of the policy are reported to (see: ReportHandler). Both the report-uri
+// directive and the Reporting API (report-to directive with the Reporting-Endpoints header) are used.
+func (c *CSP) ReportTo(uri string) *CSP {
+	c.reportURI = uri
+	return c
+}
+
+// String returns the value of the header with NonceSource not replaced
+func (c *CSP) String() string {
+	var b strings.Builder
+	for _, d := range c.directives {
+		if b.Len() > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(d.name)
+		for _, source := range d.sources {
+			b.WriteByte(' ')
+			b.WriteString(source)
+		}
+	}
+	if len(c.reportURI) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString("report-uri " + c.reportURI + "; report-to " + reportingGroup)
+	}
+
+	return b.String()
+}
+
+// compiledCSP holds the header value prepared for handling requests
+type compiledCSP struct {
+	value     string
+	nonce     bool
+	reportURI string
+}
+
+func (c *CSP) compile() *compiledCSP {
+	if c == nil {
+		return nil
+	}
+
+	value := c.String()
+	return &compiledCSP{
+		value:     value,
+		nonce:     strings.Contains(value, NonceSource),
+		reportURI: c.reportURI,
+	}
+}
+
+// header returns the value of the header for the request with given nonce
+func (c *compiledCSP) header(nonce string) string {
+	if !c.nonce {
+		return c.value
+	}
+	return strings.ReplaceAll(c.value, NonceSource, "'nonce-"+nonce+"'")
+}
+
+// set sets the policy header for the request with given nonce
+func (c *compiledCSP) set(header http.Header, name, nonce string) {
+	header.Set(name, c.header(nonce))
+	if len(c.reportURI) > 0 {
+		header.Set(ReportingEndpointsHeader, reportingEndpoints(c.reportURI))
+	}
+}
+
+// newNonce returns random base64 encoded nonce
+func newNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// reportingEndpoints returns the value of the Reporting-Endpoints header
+func reportingEndpoints(uri string) string {
+	return reportingGroup + "=" + strconv.Quote(uri)
+}
+
+// NonceFromRequest returns the CSP nonce generated for the request (empty if the policy does not use NonceSource).
+// It is meant to be passed to the templates, eg. <script nonce="{{ .Nonce }}">.
+func NonceFromRequest(r *http.Request) string {
+	return NonceFromContext(r.Context())
+}
+
+// NonceFromContext returns the CSP nonce generated for the request from the context
+func NonceFromContext(ctx context.Context) string {
+	if nonce, ok := ctx.Value(nonceKey).(string); ok {
+		return nonce
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package secure
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSP(t *testing.T) {
+	csp := NewCSP().
+		Add(DefaultSrc, Self).
+		Add(ScriptSrc, NonceSource, StrictDynamic).
+		Add(ObjectSrc, None).
+		Add("Script-Src", "https://cdn.example.com").
+		Add(UpgradeInsecureRequests)
+	assert.Equal(t, "default-src 'self'; script-src 'nonce' 'strict-dynamic' https://cdn.example.com; "+
+		"object-src 'none'; upgrade-insecure-requests", csp.String(), "invalid policy")
+
+	compiled := csp.compile()
+	assert.True(t, compiled.nonce, "policy should use the nonce")
+	assert.Equal(t, "default-src 'self'; script-src 'nonce-abc' 'strict-dynamic' https://cdn.example.com; "+
+		"object-src 'none'; upgrade-insecure-requests", compiled.header("abc"), "nonce not replaced")
+
+	csp = NewCSP().Add(DefaultSrc, Self).ReportTo("/csp-report")
+	assert.Equal(t, "default-src 'self'; report-uri /csp-report; report-to csp-endpoint", csp.String(),
+		"invalid policy with reporting")
+	assert.False(t, csp.compile().nonce, "policy should not use the nonce")
+
+	header := http.Header{}
+	csp.compile().set(header, ContentSecurityPolicyHeader, "")
+	assert.Equal(t, `csp-endpoint="/csp-report"`, header.Get(ReportingEndpointsHeader), "invalid reporting endpoint")
+
+	var nilCSP *CSP
+	assert.Nil(t, nilCSP.compile(), "missing policy should not be compiled")
+}
+
+func TestNonce(t *testing.T) {
+	first, err := newNonce()
+	assert.NoError(t, err, "could not generate nonce")
+	second, err := newNonce()
+	assert.NoError(t, err, "could not generate nonce")
+	assert.Len(t, first, 24, "invalid nonce length")
+	assert.NotEqual(t, first, second, "nonces should be random")
+
+	assert.Empty(t, NonceFromContext(context.Background()), "nonce should be empty when not generated")
+	assert.Equal(t, first, NonceFromContext(context.WithValue(context.Background(), nonceKey, first)),
+		"invalid nonce from context")
+}
@@ -0,0 +1,144 @@
+package secure
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/harnash/go-middlewares/logging"
+)
+
+// maxReportSize is the maximum size of the violation report body
+const maxReportSize = 64 << 10
+
+// violation holds the CSP violation report sent with the report-uri directive ("application/csp-report")
+type violation struct {
+	DocumentURI        string `json:"document-uri"`
+	Referrer           string `json:"referrer"`
+	BlockedURI         string `json:"blocked-uri"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	OriginalPolicy     string `json:"original-policy"`
+	Disposition        string `json:"disposition"`
+	SourceFile         string `json:"source-file"`
+	LineNumber         int    `json:"line-number"`
+	ColumnNumber       int    `json:"column-number"`
+	StatusCode         int    `json:"status-code"`
+	Sample             string `json:"script-sample"`
+}
+
+// report holds the report sent with the Reporting API ("application/reports+json")
+type report struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		Referrer           string `json:"referrer"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		OriginalPolicy     string `json:"originalPolicy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+		ColumnNumber       int    `json:"columnNumber"`
+		StatusCode         int    `json:"statusCode"`
+		Sample             string `json:"sample"`
+	} `json:"body"`
+}
+
+// violation converts the report to the violation
+func (r report) violation() violation {
+	return violation{
+		DocumentURI:        r.Body.DocumentURL,
+		Referrer:           r.Body.Referrer,
+		BlockedURI:         r.Body.BlockedURL,
+		ViolatedDirective:  r.Body.EffectiveDirective,
+		EffectiveDirective: r.Body.EffectiveDirective,
+		OriginalPolicy:     r.Body.OriginalPolicy,
+		Disposition:        r.Body.Disposition,
+		SourceFile:         r.Body.SourceFile,
+		LineNumber:         r.Body.LineNumber,
+		ColumnNumber:       r.Body.ColumnNumber,
+		StatusCode:         r.Body.StatusCode,
+		Sample:             r.Body.Sample,
+	}
+}
+
+// decodeViolations returns the CSP violations from the request body in any of the supported formats
+func decodeViolations(r *http.Request) ([]violation, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	decoder := json.NewDecoder(r.Body)
+
+	if mediaType == "application/reports+json" {
+		var reports []report
+		if err := decoder.Decode(&reports); err != nil {
+			return nil, err
+		}
+
+		var violations []violation
+		for _, report := range reports {
+			if report.Type == "csp-violation" {
+				violations = append(violations, report.violation())
+			}
+		}
+		return violations, nil
+	}
+
+	var legacy struct {
+		Report violation `json:"csp-report"`
+	}
+	if err := decoder.Decode(&legacy); err != nil {
+		return nil, err
+	}
+	return []violation{legacy.Report}, nil
+}
+
+// ReportHandler returns the handler receiving the Content Security Policy violation reports (see: CSP.ReportTo). Both
+// the report-uri ("application/csp-report") and the Reporting API ("application/reports+json") formats are accepted.
+// The violations are logged with the request logger (see: logging.InContext).
+func ReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxReportSize)
+		violations, err := decodeViolations(r)
+		logger := logging.FromRequest(r)
+		if err != nil {
+			if logger != nil {
+				logger.With("error", err).Info("could not decode CSP violation report")
+			}
+			status := http.StatusBadRequest
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		if logger != nil {
+			for _, v := range violations {
+				logger.With(
+					"document_uri", v.DocumentURI,
+					"referrer", v.Referrer,
+					"blocked_uri", v.BlockedURI,
+					"violated_directive", v.ViolatedDirective,
+					"effective_directive", v.EffectiveDirective,
+					"original_policy", v.OriginalPolicy,
+					"disposition", v.Disposition,
+					"source_file", v.SourceFile,
+					"line_number", v.LineNumber,
+					"column_number", v.ColumnNumber,
+					"status_code", v.StatusCode,
+					"sample", v.Sample,
+				).Warn("content security policy violated")
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
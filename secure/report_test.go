@@ -0,0 +1,72 @@
+package secure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestReportHandler(t *testing.T) {
+	logWatcher, logs := observer.New(zapcore.DebugLevel)
+	customLog := logging.LogGetter(func() (*zap.SugaredLogger, error) {
+		return zap.New(logWatcher).Sugar(), nil
+	})
+	handler := logging.InContext(logging.WithLogger(customLog))(ReportHandler())
+
+	legacy := `{"csp-report": {"document-uri": "https://example.com/page", "blocked-uri": "inline",
+		"violated-directive": "script-src-elem", "effective-directive": "script-src-elem",
+		"disposition": "enforce", "line-number": 12}}`
+	r := httptest.NewRequest("POST", "/csp-report", strings.NewReader(legacy))
+	r.Header.Set("Content-Type", "application/csp-report")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusNoContent, rec.Code, "invalid status")
+	if assert.Equal(t, 1, logs.Len(), "violation not logged") {
+		entry := logs.TakeAll()[0]
+		assert.Equal(t, zapcore.WarnLevel, entry.Level, "invalid log level")
+		fields := entry.ContextMap()
+		assert.Equal(t, "https://example.com/page", fields["document_uri"], "invalid document URI")
+		assert.Equal(t, "inline", fields["blocked_uri"], "invalid blocked URI")
+		assert.Equal(t, "script-src-elem", fields["violated_directive"], "invalid directive")
+		assert.EqualValues(t, 12, fields["line_number"], "invalid line number")
+	}
+
+	reports := `[{"type": "csp-violation", "url": "https://example.com/page", "body": {
+		"documentURL": "https://example.com/page", "blockedURL": "https://evil.com/x.js",
+		"effectiveDirective": "script-src", "disposition": "report"}},
+		{"type": "deprecation", "body": {"id": "feature"}}]`
+	r = httptest.NewRequest("POST", "/csp-report", strings.NewReader(reports))
+	r.Header.Set("Content-Type", "application/reports+json; charset=utf-8")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusNoContent, rec.Code, "invalid status")
+	if assert.Equal(t, 1, logs.Len(), "only CSP violations should be logged") {
+		fields := logs.TakeAll()[0].ContextMap()
+		assert.Equal(t, "https://evil.com/x.js", fields["blocked_uri"], "invalid blocked URI")
+		assert.Equal(t, "script-src", fields["effective_directive"], "invalid directive")
+		assert.Equal(t, "report", fields["disposition"], "invalid disposition")
+	}
+
+	r = httptest.NewRequest("POST", "/csp-report", strings.NewReader("not json"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "malformed report should be rejected")
+
+	r = httptest.NewRequest("POST", "/csp-report", strings.NewReader(`{"csp-report": {"sample": "`+
+		strings.Repeat("a", maxReportSize)+`"}}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, "too large report should be rejected")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/csp-report", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code, "only POST should be allowed")
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"), "allowed methods not listed")
+}
@@ -0,0 +1,225 @@
+package secure
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/harnash/go-middlewares"
+	"github.com/harnash/go-middlewares/logging"
+)
+
+// Security response headers
+const (
+	StrictTransportSecurityHeader         = "Strict-Transport-Security"
+	ContentTypeOptionsHeader              = "X-Content-Type-Options"
+	FrameOptionsHeader                    = "X-Frame-Options"
+	ReferrerPolicyHeader                  = "Referrer-Policy"
+	PermissionsPolicyHeader               = "Permissions-Policy"
+	CrossOriginOpenerPolicyHeader         = "Cross-Origin-Opener-Policy"
+	CrossOriginEmbedderPolicyHeader       = "Cross-Origin-Embedder-Policy"
+	CrossOriginResourcePolicyHeader       = "Cross-Origin-Resource-Policy"
+	ContentSecurityPolicyHeader           = "Content-Security-Policy"
+	ContentSecurityPolicyReportOnlyHeader = "Content-Security-Policy-Report-Only"
+	ReportingEndpointsHeader              = "Reporting-Endpoints"
+)
+
+// ForwardedProtoHeader is the header carrying the protocol of the request received by the proxy
+const ForwardedProtoHeader = "X-Forwarded-Proto"
+
+type options struct {
+	hstsMaxAge            time.Duration
+	hstsIncludeSubdomains bool
+	hstsPreload           bool
+	forwardedProto        bool
+	noSniff               bool
+	frameOptions          string
+	referrerPolicy        string
+	permissionsPolicy     string
+	openerPolicy          string
+	embedderPolicy        string
+	resourcePolicy        string
+	csp                   *CSP
+	cspReportOnly         *CSP
+}
+
+// Option represents a security headers option.
+type Option func(*options)
+
+// WithHSTS enables HTTP Strict Transport Security. The header is sent only in responses to the requests received over
+// TLS as the clients ignore it otherwise (see: WithForwardedProto).
+func WithHSTS(maxAge time.Duration, includeSubdomains, preload bool) Option {
+	return func(o *options) {
+		o.hstsMaxAge = maxAge
+		o.hstsIncludeSubdomains = includeSubdomains
+		o.hstsPreload = preload
+	}
+}
+
+// WithForwardedProto makes the requests with "X-Forwarded-Proto: https" header count as received over TLS (disabled by
+// default). Enable it only if the service is reachable solely through the proxy terminating TLS which overwrites the
+// header as it is sent by the client as is otherwise.
+func WithForwardedProto(enabled bool) Option {
+	return func(o *options) {
+		o.forwardedProto = enabled
+	}
+}
+
+// WithNoSniff sets if the "X-Content-Type-Options: nosniff" header is sent (enabled by default)
+func WithNoSniff(noSniff bool) Option {
+	return func(o *options) {
+		o.noSniff = noSniff
+	}
+}
+
+// WithFrameOptions sets the X-Frame-Options header ("DENY" by default, empty disables the header)
+func WithFrameOptions(value string) Option {
+	return func(o *options) {
+		o.frameOptions = value
+	}
+}
+
+// WithReferrerPolicy sets the Referrer-Policy header ("strict-origin-when-cross-origin" by default, empty disables
+// the header)
+func WithReferrerPolicy(value string) Option {
+	return func(o *options) {
+		o.referrerPolicy = value
+	}
+}
+
+// WithPermissionsPolicy sets the Permissions-Policy header, eg. "camera=(), geolocation=(self)"
+func WithPermissionsPolicy(value string) Option {
+	return func(o *options) {
+		o.permissionsPolicy = value
+	}
+}
+
+// WithCrossOriginPolicies sets the Cross-Origin-Opener-Policy, Cross-Origin-Embedder-Policy and
+// Cross-Origin-Resource-Policy headers. By default the opener and resource policies are "same-origin" and the
+// embedder policy is not sent. Empty values disable the headers.
+func WithCrossOriginPolicies(opener, embedder, resource string) Option {
+	return func(o *options) {
+		o.openerPolicy = opener
+		o.embedderPolicy = embedder
+		o.resourcePolicy = resource
+	}
+}
+
+// WithCSP sets the enforced Content Security Policy
+func WithCSP(csp *CSP) Option {
+	return func(o *options) {
+		o.csp = csp
+	}
+}
+
+// WithCSPReportOnly sets the Content Security Policy that is only reported, not enforced, by the clients. It can be
+// used together with WithCSP to test a stricter policy, both policies use the same nonce and should be reported to
+// the same URI.
+func WithCSPReportOnly(csp *CSP) Option {
+	return func(o *options) {
+		o.cspReportOnly = csp
+	}
+}
+
+// newOptions takes functional options and returns options.
+func newOptions(opts ...Option) *options {
+	cfg := &options{
+		noSniff:        true,
+		frameOptions:   "DENY",
+		referrerPolicy: "strict-origin-when-cross-origin",
+		openerPolicy:   "same-origin",
+		resourcePolicy: "same-origin",
+	}
+
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	return cfg
+}
+
+// staticHeaders returns the headers that are the same in all the responses
+func (o *options) staticHeaders() http.Header {
+	header := http.Header{}
+	set := func(name, value string) {
+		if len(value) > 0 {
+			header.Set(name, value)
+		}
+	}
+
+	if o.noSniff {
+		set(ContentTypeOptionsHeader, "nosniff")
+	}
+	set(FrameOptionsHeader, o.frameOptions)
+	set(ReferrerPolicyHeader, o.referrerPolicy)
+	set(PermissionsPolicyHeader, o.permissionsPolicy)
+	set(CrossOriginOpenerPolicyHeader, o.openerPolicy)
+	set(CrossOriginEmbedderPolicyHeader, o.embedderPolicy)
+	set(CrossOriginResourcePolicyHeader, o.resourcePolicy)
+
+	return header
+}
+
+// hsts returns the value of the Strict-Transport-Security header
+func (o *options) hsts() string {
+	if o.hstsMaxAge <= 0 {
+		return ""
+	}
+
+	value := "max-age=" + strconv.FormatInt(int64(o.hstsMaxAge/time.Second), 10)
+	if o.hstsIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if o.hstsPreload {
+		value += "; preload"
+	}
+	return value
+}
+
+// Secured will set the security headers in all the responses. The headers are set before calling the handler so it
+// can override them. If the Content Security Policy uses NonceSource a new nonce is generated for every request and
+// stored in its context (see: NonceFromRequest).
+func Secured(options ...Option) middlewares.Middleware {
+	o := newOptions(options...)
+	static := o.staticHeaders()
+	hsts := o.hsts()
+	csp := o.csp.compile()
+	cspReportOnly := o.cspReportOnly.compile()
+	nonce := (csp != nil && csp.nonce) || (cspReportOnly != nil && cspReportOnly.nonce)
+
+	fn := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			for name := range static {
+				header.Set(name, static.Get(name))
+			}
+			if len(hsts) > 0 && (r.TLS != nil || o.forwardedProto && r.Header.Get(ForwardedProtoHeader) == "https") {
+				header.Set(StrictTransportSecurityHeader, hsts)
+			}
+
+			var value string
+			if nonce {
+				var err error
+				if value, err = newNonce(); err != nil {
+					if logger := logging.FromRequest(r); logger != nil {
+						logger.With("error", err).Error("could not generate CSP nonce")
+					}
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+				r = r.WithContext(context.WithValue(r.Context(), nonceKey, value))
+			}
+			if cspReportOnly != nil {
+				cspReportOnly.set(header, ContentSecurityPolicyReportOnlyHeader, value)
+			}
+			if csp != nil {
+				csp.set(header, ContentSecurityPolicyHeader, value)
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	return fn
+}
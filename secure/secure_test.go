@@ -0,0 +1,100 @@
+package secure
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecuredDefaults(t *testing.T) {
+	handler := Secured()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, NonceFromRequest(r), "nonce should not be generated without the policy")
+		w.Header().Set(FrameOptionsHeader, "SAMEORIGIN")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "nosniff", rec.Header().Get(ContentTypeOptionsHeader), "invalid content type options")
+	assert.Equal(t, "SAMEORIGIN", rec.Header().Get(FrameOptionsHeader), "handler should override the headers")
+	assert.Equal(t, "strict-origin-when-cross-origin", rec.Header().Get(ReferrerPolicyHeader), "invalid referrer policy")
+	assert.Equal(t, "same-origin", rec.Header().Get(CrossOriginOpenerPolicyHeader), "invalid opener policy")
+	assert.Equal(t, "same-origin", rec.Header().Get(CrossOriginResourcePolicyHeader), "invalid resource policy")
+	for _, header := range []string{StrictTransportSecurityHeader, PermissionsPolicyHeader,
+		CrossOriginEmbedderPolicyHeader, ContentSecurityPolicyHeader, ContentSecurityPolicyReportOnlyHeader} {
+		assert.Empty(t, rec.Header().Get(header), "%s should not be set by default", header)
+	}
+}
+
+func TestSecuredOptions(t *testing.T) {
+	handler := Secured(WithNoSniff(false), WithFrameOptions(""), WithReferrerPolicy("no-referrer"),
+		WithPermissionsPolicy("camera=(), geolocation=(self)"),
+		WithCrossOriginPolicies("same-origin-allow-popups", "require-corp", "cross-origin"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Empty(t, rec.Header().Get(ContentTypeOptionsHeader), "content type options should be disabled")
+	assert.Empty(t, rec.Header().Get(FrameOptionsHeader), "frame options should be disabled")
+	assert.Equal(t, "no-referrer", rec.Header().Get(ReferrerPolicyHeader), "invalid referrer policy")
+	assert.Equal(t, "camera=(), geolocation=(self)", rec.Header().Get(PermissionsPolicyHeader),
+		"invalid permissions policy")
+	assert.Equal(t, "same-origin-allow-popups", rec.Header().Get(CrossOriginOpenerPolicyHeader),
+		"invalid opener policy")
+	assert.Equal(t, "require-corp", rec.Header().Get(CrossOriginEmbedderPolicyHeader), "invalid embedder policy")
+	assert.Equal(t, "cross-origin", rec.Header().Get(CrossOriginResourcePolicyHeader), "invalid resource policy")
+}
+
+func TestSecuredHSTS(t *testing.T) {
+	handler := Secured(WithHSTS(365*24*time.Hour, true, true))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Empty(t, rec.Header().Get(StrictTransportSecurityHeader), "HSTS should not be sent over plain HTTP")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.TLS = &tls.ConnectionState{}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, "max-age=31536000; includeSubDomains; preload", rec.Header().Get(StrictTransportSecurityHeader),
+		"invalid HSTS header")
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(ForwardedProtoHeader, "https")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Empty(t, rec.Header().Get(StrictTransportSecurityHeader), "forwarded protocol should not be trusted by default")
+
+	rec = httptest.NewRecorder()
+	Secured(WithHSTS(time.Hour, false, false), WithForwardedProto(true))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, r)
+	assert.Equal(t, "max-age=3600", rec.Header().Get(StrictTransportSecurityHeader), "HSTS should be sent behind proxy")
+}
+
+func TestSecuredCSP(t *testing.T) {
+	var nonces []string
+	handler := Secured(
+		WithCSP(NewCSP().Add(DefaultSrc, Self).Add(ScriptSrc, NonceSource)),
+		WithCSPReportOnly(NewCSP().Add(DefaultSrc, None).Add(StyleSrc, NonceSource).ReportTo("/csp-report")),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, NonceFromRequest(r))
+	}))
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		nonce := nonces[len(nonces)-1]
+		assert.NotEmpty(t, nonce, "nonce not generated")
+		assert.Equal(t, "default-src 'self'; script-src 'nonce-"+nonce+"'",
+			rec.Header().Get(ContentSecurityPolicyHeader), "invalid enforced policy")
+		assert.Equal(t, "default-src 'none'; style-src 'nonce-"+nonce+"'; report-uri /csp-report; report-to csp-endpoint",
+			rec.Header().Get(ContentSecurityPolicyReportOnlyHeader), "invalid report-only policy")
+		assert.Equal(t, `csp-endpoint="/csp-report"`, rec.Header().Get(ReportingEndpointsHeader),
+			"invalid reporting endpoint")
+	}
+	assert.NotEqual(t, nonces[0], nonces[1], "nonce should be generated for every request")
+}
@@ -0,0 +1,105 @@
+package timeout
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers carrying the deadline of the caller
+const (
+	// RequestTimeoutHeader holds the timeout in seconds (eg. "1.5") or as a Go duration (eg. "1500ms")
+	RequestTimeoutHeader = "X-Request-Timeout"
+	// GRPCTimeoutHeader holds the timeout in the gRPC format: up to 8 digits followed by a unit (H, M, S, m, u, n)
+	GRPCTimeoutHeader = "Grpc-Timeout"
+)
+
+// maxDuration is the longest time.Duration, timeouts overflowing it are capped to it
+const maxDuration = time.Duration(math.MaxInt64)
+
+// parseRequestTimeout parses the value of the X-Request-Timeout header. Timeouts that are not positive are invalid.
+func parseRequestTimeout(value string) (time.Duration, bool) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+		switch {
+		case !(seconds > 0):
+			return 0, false
+		case seconds >= float64(maxDuration)/float64(time.Second):
+			return maxDuration, true
+		}
+		if d := time.Duration(seconds * float64(time.Second)); d > 0 {
+			return d, true
+		}
+		return 0, false
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d, true
+	}
+
+	return 0, false
+}
+
+// parseGRPCTimeout parses the value of the grpc-timeout header. Timeouts that are not positive are invalid.
+func parseGRPCTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
+
+	amount, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || amount <= 0 {
+		return 0, false
+	}
+
+	var unit time.Duration
+	switch value[len(value)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, false
+	}
+
+	if amount > int64(maxDuration/unit) {
+		return maxDuration, true
+	}
+	return time.Duration(amount) * unit, true
+}
+
+// headerTimeout returns the shortest timeout found in given headers of the request capped to the maximum
+func headerTimeout(r *http.Request, headers []string, max time.Duration) (time.Duration, bool) {
+	var timeout time.Duration
+	found := false
+	for _, name := range headers {
+		value := r.Header.Get(name)
+		if len(value) == 0 {
+			continue
+		}
+
+		var d time.Duration
+		var ok bool
+		if http.CanonicalHeaderKey(name) == GRPCTimeoutHeader {
+			d, ok = parseGRPCTimeout(value)
+		} else {
+			d, ok = parseRequestTimeout(value)
+		}
+		if ok && (!found || d < timeout) {
+			timeout = d
+			found = true
+		}
+	}
+	if found && timeout > max {
+		timeout = max
+	}
+
+	return timeout, found
+}
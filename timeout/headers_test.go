@@ -0,0 +1,95 @@
+package timeout
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRequestTimeout(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		"seconds":           {value: "2", expected: 2 * time.Second, ok: true},
+		"fractional":        {value: "1.5", expected: 1500 * time.Millisecond, ok: true},
+		"duration":          {value: "250ms", expected: 250 * time.Millisecond, ok: true},
+		"invalid":           {value: "soon", ok: false},
+		"zero":              {value: "0", ok: false},
+		"negative":          {value: "-1.5", ok: false},
+		"negative duration": {value: "-250ms", ok: false},
+		"zero duration":     {value: "0s", ok: false},
+		"not a number":      {value: "NaN", ok: false},
+		"too short":         {value: "1e-12", ok: false},
+		"overflow":          {value: "1e300", expected: maxDuration, ok: true},
+		"out of range":      {value: "1e400", expected: maxDuration, ok: true},
+		"infinity":          {value: "+Inf", expected: maxDuration, ok: true},
+		"duration overflow": {value: "9999999999h", ok: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, ok := parseRequestTimeout(test.value)
+			assert.Equal(t, test.ok, ok, "invalid parse result")
+			assert.Equal(t, test.expected, d, "invalid timeout")
+		})
+	}
+}
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		"hours":        {value: "1H", expected: time.Hour, ok: true},
+		"minutes":      {value: "2M", expected: 2 * time.Minute, ok: true},
+		"seconds":      {value: "3S", expected: 3 * time.Second, ok: true},
+		"milliseconds": {value: "100m", expected: 100 * time.Millisecond, ok: true},
+		"microseconds": {value: "5u", expected: 5 * time.Microsecond, ok: true},
+		"nanoseconds":  {value: "99999999n", expected: 99999999 * time.Nanosecond, ok: true},
+		"too long":     {value: "123456789n", ok: false},
+		"no amount":    {value: "S", ok: false},
+		"bad unit":     {value: "10s", ok: false},
+		"negative":     {value: "-1S", ok: false},
+		"zero":         {value: "0m", ok: false},
+		"overflow":     {value: "99999999H", expected: maxDuration, ok: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, ok := parseGRPCTimeout(test.value)
+			assert.Equal(t, test.ok, ok, "invalid parse result")
+			assert.Equal(t, test.expected, d, "invalid timeout")
+		})
+	}
+}
+
+func TestHeaderTimeout(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	_, ok := headerTimeout(r, []string{RequestTimeoutHeader, GRPCTimeoutHeader}, time.Minute)
+	assert.False(t, ok, "timeout without headers")
+
+	r.Header.Set(RequestTimeoutHeader, "2")
+	r.Header.Set("grpc-timeout", "500m")
+	d, ok := headerTimeout(r, []string{RequestTimeoutHeader, "grpc-timeout"}, time.Minute)
+	assert.True(t, ok, "timeout not found")
+	assert.Equal(t, 500*time.Millisecond, d, "shortest timeout should be used")
+
+	d, ok = headerTimeout(r, []string{RequestTimeoutHeader}, time.Minute)
+	assert.True(t, ok, "timeout not found")
+	assert.Equal(t, 2*time.Second, d, "only configured headers should be used")
+
+	r.Header.Set(RequestTimeoutHeader, "0")
+	r.Header.Set("grpc-timeout", "99999999H")
+	d, ok = headerTimeout(r, []string{RequestTimeoutHeader, "grpc-timeout"}, time.Minute)
+	assert.True(t, ok, "timeout not found")
+	assert.Equal(t, time.Minute, d, "invalid timeout should be ignored and the valid one capped to the maximum")
+
+	r.Header.Set("grpc-timeout", "-1S")
+	_, ok = headerTimeout(r, []string{RequestTimeoutHeader, "grpc-timeout"}, time.Minute)
+	assert.False(t, ok, "invalid timeouts should be ignored")
+}
@@ -0,0 +1,218 @@
+package timeout
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/harnash/go-middlewares"
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type options struct {
+	metrics  Metrics
+	name     string
+	routes   map[string]time.Duration
+	headers  []string
+	response http.Handler
+}
+
+// Option represents a timeout option.
+type Option func(*options)
+
+// WithMetrics sets custom metric collector/container for timeout metrics
+func WithMetrics(metrics Metrics) Option {
+	return func(o *options) {
+		o.metrics = metrics
+	}
+}
+
+// WithName sets the name of the handler used in metrics ("default" by default)
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithRouteTimeouts overrides the timeout for the request paths (or the http.ServeMux patterns) found in the map
+func WithRouteTimeouts(timeouts map[string]time.Duration) Option {
+	return func(o *options) {
+		o.routes = timeouts
+	}
+}
+
+// WithDeadlineHeaders sets the headers carrying the timeout of the caller (RequestTimeoutHeader and GRPCTimeoutHeader
+// by default). Timeout of the caller can only shorten the timeout of the route, values that are not positive are
+// ignored. No headers disables this feature.
+func WithDeadlineHeaders(headers ...string) Option {
+	return func(o *options) {
+		o.headers = headers
+	}
+}
+
+// WithResponse sets the handler writing the response of timed out requests (503 Service Unavailable by default). The
+// handler gets the original request with expired context.
+func WithResponse(response http.Handler) Option {
+	return func(o *options) {
+		o.response = response
+	}
+}
+
+// StatusResponse returns the handler writing the response with given status code (eg. http.StatusGatewayTimeout)
+// to be used with WithResponse
+func StatusResponse(code int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, fmt.Sprintf("%d - %s", code, http.StatusText(code)), code)
+	})
+}
+
+// Metrics defines interface for custom metric collector/container
+type Metrics interface {
+	prometheus.Collector
+	GetTimeouts() *prometheus.CounterVec
+}
+
+// defaultMetrics holds all the metrics of timed out requests
+type defaultMetrics struct {
+	timeouts *prometheus.CounterVec
+}
+
+var basicMetrics = newDefaultMetrics()
+
+// GetTimeouts return metric that counts timed out requests
+func (s defaultMetrics) GetTimeouts() *prometheus.CounterVec {
+	return s.timeouts
+}
+
+// newDefaultMetrics creates new timeout metrics
+func newDefaultMetrics() Metrics {
+	timeouts := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_request_timeouts_total",
+		Help: "number of timed out requests by the source of the deadline and whether the response was committed",
+	}, []string{"handler_name", "source", "committed"})
+
+	return defaultMetrics{timeouts: timeouts}
+}
+
+// Describe implements prometheus Collector interface.
+func (s defaultMetrics) Describe(in chan<- *prometheus.Desc) {
+	s.timeouts.Describe(in)
+}
+
+// Collect implements prometheus Collector interface.
+func (s defaultMetrics) Collect(in chan<- prometheus.Metric) {
+	s.timeouts.Collect(in)
+}
+
+// RegisterDefaultMetrics will register default timeout metrics instance in Prometheus. This is only needed if
+// any handlers are wrapped with default metrics (not overridden by WithMetrics() option)
+func RegisterDefaultMetrics(registerer prometheus.Registerer) error {
+	return registerer.Register(basicMetrics)
+}
+
+// UnregisterDefaultMetrics is a companion function to RegisterDefaultMetrics and must be called if RegisterDefaultMetrics
+// is used to cleanup the metrics in Prometheus
+func UnregisterDefaultMetrics(registerer prometheus.Registerer) {
+	registerer.Unregister(basicMetrics)
+}
+
+// newOptions takes functional options and returns options.
+func newOptions(opts ...Option) *options {
+	cfg := &options{
+		metrics:  basicMetrics,
+		name:     "default",
+		headers:  []string{RequestTimeoutHeader, GRPCTimeoutHeader},
+		response: StatusResponse(http.StatusServiceUnavailable),
+	}
+
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	return cfg
+}
+
+// timeout returns the timeout of the request and its source ("route" or "header")
+func (o *options) timeout(r *http.Request, fallback time.Duration) (time.Duration, string) {
+	timeout := fallback
+	if d, ok := o.routes[r.URL.Path]; ok {
+		timeout = d
+	} else if d, ok := o.routes[r.Pattern]; ok && len(r.Pattern) > 0 {
+		timeout = d
+	}
+
+	if d, ok := headerTimeout(r, o.headers, timeout); ok && d < timeout {
+		return d, "header"
+	}
+
+	return timeout, "route"
+}
+
+// Timeout will cancel the context of the request after the timeout (overridden per route with WithRouteTimeouts() or
+// shortened by the caller with a deadline header) and write the timeout response if the handler did not commit the
+// response yet. Unlike http.TimeoutHandler the response is not buffered: writes are passed through (Flusher is
+// preserved) until the deadline and discarded afterwards. Handler keeps running in the background until it returns,
+// so it should respect the cancellation of the request context.
+func Timeout(timeout time.Duration, options ...Option) middlewares.Middleware {
+	o := newOptions(options...)
+
+	fn := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d, source := o.timeout(r, timeout)
+			parent := r.Context()
+			ctx, cancel := context.WithTimeout(parent, d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := newTimeoutWriter(ctx, w)
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			// timeout might leave no time for the handler
+			if d > 0 {
+				go func() {
+					defer func() {
+						if p := recover(); p != nil {
+							panicked <- p
+						}
+					}()
+					h.ServeHTTP(tw, r)
+					close(done)
+				}()
+			}
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+			case <-ctx.Done():
+				// request cancelled by the client or the deadline of the parent context (eg. set by another middleware
+				// which responds on its own) is not a timeout of this middleware
+				if parent.Err() != nil {
+					tw.timedOut(func(http.ResponseWriter) {})
+					return
+				}
+
+				committed := tw.timedOut(func(w http.ResponseWriter) {
+					o.response.ServeHTTP(w, r)
+				})
+				o.metrics.GetTimeouts().WithLabelValues(o.name, source, strconv.FormatBool(committed)).Inc()
+				if span := opentracing.SpanFromContext(ctx); span != nil {
+					ext.Error.Set(span, true)
+					span.SetTag("timeout", true)
+					span.LogKV("event", "timeout", "timeout_ns", d.Nanoseconds(), "committed", committed)
+				}
+				if logger := logging.FromRequest(r); logger != nil {
+					logger.With("timeout_ns", d.Nanoseconds(), "timeout_source", source, "committed", committed).
+						Warn("request timed out")
+				}
+			}
+		})
+	}
+
+	return fn
+}
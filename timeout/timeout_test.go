@@ -0,0 +1,209 @@
+package timeout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTimeout(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := newDefaultMetrics()
+	assert.NoError(t, registry.Register(metrics), "could not register timeout metrics")
+
+	logWatcher, logs := observer.New(zapcore.DebugLevel)
+	customLog := logging.LogGetter(func() (*zap.SugaredLogger, error) {
+		return zap.New(logWatcher).Sugar(), nil
+	})
+
+	tracer := mocktracer.New()
+	finished := make(chan error, 1)
+	hanging := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "yes")
+		<-r.Context().Done()
+		_, err := w.Write([]byte("too late"))
+		finished <- err
+	})
+	handler := logging.InContext(logging.WithLogger(customLog))(
+		Timeout(10*time.Millisecond, WithMetrics(metrics), WithName("api"))(hanging))
+
+	span := tracer.StartSpan("request")
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(opentracing.ContextWithSpan(r.Context(), span))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	span.Finish()
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "timeout response not written")
+	assert.Empty(t, rec.Header().Get("X-Handler"), "headers of the timed out handler should be discarded")
+	assert.ErrorIs(t, <-finished, http.ErrHandlerTimeout, "late write should fail")
+	assert.Equal(t, "503 - Service Unavailable\n", rec.Body.String(), "late write should be discarded")
+
+	body := assert.HTTPBody(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP, "GET", "/", url.Values{})
+	assert.Contains(t, body, `http_request_timeouts_total{committed="false",handler_name="api",source="route"} 1`,
+		"timeout not counted")
+
+	if assert.Equal(t, 1, logs.FilterMessage("request timed out").Len(), "timeout not logged") {
+		assert.Equal(t, int64(10*time.Millisecond), logs.FilterMessage("request timed out").All()[0].ContextMap()["timeout_ns"],
+			"timeout not logged")
+	}
+	if spans := tracer.FinishedSpans(); assert.Len(t, spans, 1, "span not finished") {
+		assert.Equal(t, true, spans[0].Tag("timeout"), "span not tagged")
+		assert.Equal(t, true, spans[0].Tag("error"), "span not marked as failed")
+	}
+}
+
+func TestTimeoutCommitted(t *testing.T) {
+	metrics := newDefaultMetrics()
+	streaming := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	rec := httptest.NewRecorder()
+	Timeout(10*time.Millisecond, WithMetrics(metrics))(streaming).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "committed status should be kept")
+	assert.True(t, rec.Flushed, "flush should be passed through")
+	assert.Equal(t, "partial", rec.Body.String(), "committed body should be kept")
+	assert.Equal(t, 1.0, testCounter(t, metrics, "default", "route", "true"), "timeout not counted")
+}
+
+func TestTimeoutFastHandler(t *testing.T) {
+	metrics := newDefaultMetrics()
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.Context().Deadline()
+		assert.True(t, ok, "request should have a deadline")
+		w.Header().Set("X-Handler", "yes")
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	rec := httptest.NewRecorder()
+	Timeout(time.Second, WithMetrics(metrics))(fast).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusCreated, rec.Code, "invalid status")
+	assert.Equal(t, "yes", rec.Header().Get("X-Handler"), "headers not written")
+	assert.Zero(t, testCounter(t, metrics, "default", "route", "false"), "fast handler should not time out")
+}
+
+func TestTimeoutDeadlineHeader(t *testing.T) {
+	metrics := newDefaultMetrics()
+	called := false
+	handler := Timeout(time.Second, WithMetrics(metrics), WithResponse(StatusResponse(http.StatusGatewayTimeout)))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(GRPCTimeoutHeader, "0m")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.True(t, called, "handler should be called if the deadline header is invalid")
+	assert.Equal(t, http.StatusOK, rec.Code, "invalid status")
+
+	handler = Timeout(time.Second, WithMetrics(metrics), WithResponse(StatusResponse(http.StatusGatewayTimeout)))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(GRPCTimeoutHeader, "1m")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code, "custom timeout response not written")
+	assert.Equal(t, 1.0, testCounter(t, metrics, "default", "header", "false"), "timeout not counted")
+}
+
+func TestTimeoutParentDeadline(t *testing.T) {
+	metrics := newDefaultMetrics()
+	hanging := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	handler := Timeout(10*time.Millisecond, WithMetrics(metrics), WithName("outer"))(
+		Timeout(time.Minute, WithMetrics(metrics), WithName("inner"),
+			WithResponse(StatusResponse(http.StatusGatewayTimeout)))(hanging))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "response of the outer timeout should be written")
+	assert.Equal(t, 1.0, testCounter(t, metrics, "outer", "route", "false"), "outer timeout not counted")
+	assert.Zero(t, testCounter(t, metrics, "inner", "route", "false"), "deadline of the parent should not be counted")
+}
+
+func TestTimeoutResponseController(t *testing.T) {
+	errs := make(chan error, 1)
+	server := httptest.NewServer(Timeout(time.Second, WithMetrics(newDefaultMetrics()))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			errs <- http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+		})))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if assert.NoError(t, err, "request failed") {
+		_ = response.Body.Close()
+	}
+	assert.NoError(t, <-errs, "response controller should reach the connection")
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	handler := Timeout(time.Second, WithMetrics(newDefaultMetrics()))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+
+	assert.PanicsWithValue(t, "boom", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}, "panic should be propagated to the caller")
+}
+
+func TestOptionsTimeout(t *testing.T) {
+	o := newOptions(WithRouteTimeouts(map[string]time.Duration{"/slow": time.Minute, "GET /items/{id}": time.Second}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	d, source := o.timeout(r, 5*time.Second)
+	assert.Equal(t, 5*time.Second, d, "default timeout should be used")
+	assert.Equal(t, "route", source, "invalid source")
+
+	d, _ = o.timeout(httptest.NewRequest("GET", "/slow", nil), 5*time.Second)
+	assert.Equal(t, time.Minute, d, "route timeout should be used")
+
+	r = httptest.NewRequest("GET", "/items/1", nil)
+	r.Pattern = "GET /items/{id}"
+	d, _ = o.timeout(r, 5*time.Second)
+	assert.Equal(t, time.Second, d, "pattern timeout should be used")
+
+	r = httptest.NewRequest("GET", "/slow", nil)
+	r.Header.Set(RequestTimeoutHeader, "2")
+	d, source = o.timeout(r, 5*time.Second)
+	assert.Equal(t, 2*time.Second, d, "caller timeout should shorten the route timeout")
+	assert.Equal(t, "header", source, "invalid source")
+
+	r.Header.Set(RequestTimeoutHeader, "120")
+	d, source = o.timeout(r, 5*time.Second)
+	assert.Equal(t, time.Minute, d, "caller timeout should not extend the route timeout")
+	assert.Equal(t, "route", source, "invalid source")
+
+	o = newOptions(WithDeadlineHeaders())
+	r.Header.Set(RequestTimeoutHeader, "1")
+	d, _ = o.timeout(r, 5*time.Second)
+	assert.Equal(t, 5*time.Second, d, "deadline headers should be ignored")
+}
+
+// testCounter returns the number of timeouts with given labels
+func testCounter(t *testing.T, metrics Metrics, labels ...string) float64 {
+	counter, err := metrics.GetTimeouts().GetMetricWithLabelValues(labels...)
+	assert.NoError(t, err, "could not get timeout counter")
+
+	return testutil.ToFloat64(counter)
+}
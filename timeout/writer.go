@@ -0,0 +1,105 @@
+package timeout
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// timeoutWriter passes the response of the handler through until the request times out. Handler gets its own header
+// map so the timeout response can be written while the handler is still running. All writes after the timeout are
+// discarded, including the writes made after the context of the request expired but before the middleware noticed it.
+type timeoutWriter struct {
+	ctx     context.Context
+	w       http.ResponseWriter
+	header  http.Header
+	lock    sync.Mutex
+	written bool
+	timeout bool
+}
+
+func newTimeoutWriter(ctx context.Context, w http.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{ctx: ctx, w: w, header: http.Header{}}
+}
+
+// Header implements net/http.ResponseWriter's Header()
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// WriteHeader implements net/http.ResponseWriter's WriteHeader()
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	tw.writeHeader(code)
+}
+
+// writeHeader copies the headers of the handler and writes them if the request did not time out yet
+func (tw *timeoutWriter) writeHeader(code int) {
+	if tw.expired() || tw.written {
+		return
+	}
+
+	header := tw.w.Header()
+	for key, values := range tw.header {
+		header[key] = append([]string(nil), values...)
+	}
+	tw.w.WriteHeader(code)
+	// informational responses can be followed by other headers
+	if code >= 200 || code == http.StatusSwitchingProtocols {
+		tw.written = true
+	}
+}
+
+// Write implements net/http.ResponseWriter's Write(). It returns http.ErrHandlerTimeout if the request timed out.
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	if tw.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+
+	return tw.w.Write(b)
+}
+
+// Flush implements net/http.Flusher interface
+func (tw *timeoutWriter) Flush() {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	if tw.expired() {
+		return
+	}
+	tw.writeHeader(http.StatusOK)
+	if flusher, ok := tw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the original http.ResponseWriter (used by net/http.ResponseController)
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// expired reports if the writes of the handler should be discarded
+func (tw *timeoutWriter) expired() bool {
+	return tw.timeout || tw.ctx.Err() != nil
+}
+
+// timedOut marks the request as timed out and returns whether the response was already committed. The timeout
+// response must be written while the lock is held so it is passed as a callback.
+func (tw *timeoutWriter) timedOut(respond func(w http.ResponseWriter)) bool {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	tw.timeout = true
+	if tw.written {
+		return true
+	}
+
+	respond(tw.w)
+	return false
+}
@@ -0,0 +1,61 @@
+package timeout
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	tw := newTimeoutWriter(context.Background(), rec)
+
+	tw.Header().Set("X-Handler", "yes")
+	assert.Empty(t, rec.Header().Get("X-Handler"), "headers should not be shared before they are written")
+	tw.Flush()
+	assert.True(t, rec.Flushed, "flush should be passed through")
+	assert.Equal(t, "yes", rec.Header().Get("X-Handler"), "headers should be copied when written")
+
+	_, err := tw.Write([]byte("partial"))
+	assert.NoError(t, err, "write before timeout should succeed")
+
+	committed := tw.timedOut(func(w http.ResponseWriter) {
+		assert.Fail(t, "committed response should not be overwritten")
+	})
+	assert.True(t, committed, "response should be committed")
+
+	_, err = tw.Write([]byte("late"))
+	assert.ErrorIs(t, err, http.ErrHandlerTimeout, "late write should be discarded")
+	tw.WriteHeader(http.StatusInternalServerError)
+	assert.Equal(t, http.StatusOK, rec.Code, "late status should be discarded")
+	assert.Equal(t, "partial", rec.Body.String(), "invalid body")
+}
+
+func TestTimeoutWriterUncommitted(t *testing.T) {
+	rec := httptest.NewRecorder()
+	tw := newTimeoutWriter(context.Background(), rec)
+	tw.Header().Set("X-Handler", "yes")
+
+	committed := tw.timedOut(func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusGatewayTimeout)
+	})
+	assert.False(t, committed, "response should not be committed")
+	tw.Flush()
+	assert.False(t, rec.Flushed, "flush after timeout should be discarded")
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code, "timeout response should be written")
+	assert.Empty(t, rec.Header().Get("X-Handler"), "headers of the handler should be discarded")
+}
+
+func TestTimeoutWriterExpired(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	tw := newTimeoutWriter(ctx, rec)
+
+	_, err := tw.Write([]byte("late"))
+	assert.ErrorIs(t, err, http.ErrHandlerTimeout, "write after the deadline should be discarded")
+	assert.False(t, rec.Flushed || rec.Body.Len() > 0, "nothing should be written")
+}
@@ -0,0 +1,22 @@
+// Package chinaming provides the span operation namer for the github.com/go-chi/chi router, kept apart from the
+// tracing package so it does not depend on the router.
+package chinaming
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/harnash/go-middlewares/tracing"
+)
+
+// MethodAndRoute names operations as "METHOD route-template" using the route pattern of the
+// github.com/go-chi/chi router. When used as a router-level middleware the pattern is not complete until the
+// request is routed, so the span is renamed once the handler returns.
+func MethodAndRoute(r *http.Request) string {
+	routeCtx := chi.RouteContext(r.Context())
+	if routeCtx == nil {
+		return ""
+	}
+
+	return tracing.MethodAndTemplate(r.Method, routeCtx.RoutePattern())
+}
@@ -0,0 +1,36 @@
+package chinaming
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/harnash/go-middlewares/tracing"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestChiRouteNaming(t *testing.T) {
+	tracer := mocktracer.New()
+	defer tracer.Reset()
+
+	router := chi.NewRouter()
+	router.Use(tracing.Traced(tracing.WithTracer(tracer), tracing.WithNamePrefix("api_"),
+		tracing.WithOperationNamer(MethodAndRoute)))
+	router.Route("/accounts", func(r chi.Router) {
+		r.Get("/{id}", okHandler)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/accounts/5", nil))
+
+	spans := tracer.FinishedSpans()
+	if assert.Len(t, spans, 1, "did not register any span") {
+		assert.Equal(t, "api_GET /accounts/{id}", spans[0].OperationName, "span not renamed after routing")
+	}
+	assert.Empty(t, MethodAndRoute(httptest.NewRequest("GET", "/", nil)), "unrouted request should not be named")
+}
@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/harnash/go-middlewares/logging"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+const baggageKey key = 914
+
+// Extractor derives a key-value pair from the request. Empty value means that there is nothing to record.
+type Extractor func(r *http.Request) (key, value string)
+
+// FromHeader returns Extractor that will map a value of the request header to the given key
+func FromHeader(key, header string) Extractor {
+	header = http.CanonicalHeaderKey(header)
+	return func(r *http.Request) (string, string) {
+		return key, r.Header.Get(header)
+	}
+}
+
+// FromQuery returns Extractor that will map a value of the URL query parameter to the given key
+func FromQuery(key, param string) Extractor {
+	return func(r *http.Request) (string, string) {
+		return key, r.URL.Query().Get(param)
+	}
+}
+
+// FromCookie returns Extractor that will map a value of the request cookie to the given key
+func FromCookie(key, cookie string) Extractor {
+	return func(r *http.Request) (string, string) {
+		c, err := r.Cookie(cookie)
+		if err != nil {
+			return key, ""
+		}
+		return key, c.Value
+	}
+}
+
+// WithTagExtractor will add tags derived from each request to the span created by middleware
+func WithTagExtractor(extractor Extractor) Option {
+	return func(o *options) {
+		o.tagExtractors = append(o.tagExtractors, extractor)
+	}
+}
+
+// WithBaggageExtractor will set baggage derived from each request to the span created by middleware
+func WithBaggageExtractor(extractor Extractor) Option {
+	return func(o *options) {
+		o.baggageExtractors = append(o.baggageExtractors, extractor)
+	}
+}
+
+// WithLogExtractor will add logs derived from each request to the span created by middleware
+func WithLogExtractor(extractor Extractor) Option {
+	return func(o *options) {
+		o.logExtractors = append(o.logExtractors, extractor)
+	}
+}
+
+// BaggageFromRequest will return baggage items of the span created by Traced for the given request (including
+// items received from the upstream service)
+func BaggageFromRequest(r *http.Request) map[string]string {
+	return BaggageFromContext(r.Context())
+}
+
+// BaggageFromContext will return baggage items of the span created by Traced from the given context.Context object
+func BaggageFromContext(ctx context.Context) map[string]string {
+	baggage, ok := ctx.Value(baggageKey).(map[string]string)
+	if !ok {
+		return nil
+	}
+	return baggage
+}
+
+// decorate will set all static and request-derived baggage, tags and logs on the span
+func (o *options) decorate(span opentracing.Span, r *http.Request) {
+	for key, val := range o.baggage {
+		key.Set(span, val)
+	}
+
+	for key, val := range o.tags {
+		key.Set(span, val)
+	}
+
+	for key, val := range o.logs {
+		key.Set(span, val)
+	}
+
+	for _, extractor := range o.baggageExtractors {
+		key, val := extractor(r)
+		stringBaggageName(key).Set(span, val)
+	}
+
+	for _, extractor := range o.tagExtractors {
+		key, val := extractor(r)
+		stringTagName(key).Set(span, val)
+	}
+
+	for _, extractor := range o.logExtractors {
+		key, val := extractor(r)
+		stringLogName(key).Set(span, val)
+	}
+}
+
+// exposeBaggage will store baggage items of the span in the context and add them to the request logger (if any)
+func exposeBaggage(ctx context.Context, span opentracing.Span) context.Context {
+	baggage := map[string]string{}
+	span.Context().ForeachBaggageItem(func(k, v string) bool {
+		baggage[k] = v
+		return true
+	})
+
+	if len(baggage) == 0 {
+		return ctx
+	}
+
+	if logger := logging.FromContext(ctx); logger != nil {
+		for k, v := range baggage {
+			logger = logger.With("baggage_"+strings.ToLower(k), v)
+		}
+		ctx = logging.AddLoggerToContext(ctx, logger)
+	}
+
+	return context.WithValue(ctx, baggageKey, baggage)
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/harnash/go-middlewares/logging"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTracingExtractors(t *testing.T) {
+	tracer := mocktracer.New()
+	defer tracer.Reset()
+
+	handler := Traced(
+		WithTracer(tracer),
+		WithTagExtractor(FromHeader("client.version", "X-Client-Version")),
+		WithTagExtractor(FromCookie("session.kind", "kind")),
+		WithBaggageExtractor(FromQuery("tenant", "tenant")),
+		WithLogExtractor(func(r *http.Request) (string, string) { return "path", r.URL.Path }),
+		WithTagExtractor(FromHeader("missing", "X-Missing")),
+	)(http.HandlerFunc(okHandler))
+
+	req := httptest.NewRequest("GET", "/orders?tenant=acme", nil)
+	req.Header.Set("X-Client-Version", "1.2.3")
+	req.AddCookie(&http.Cookie{Name: "kind", Value: "guest"})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if assert.Len(t, tracer.FinishedSpans(), 1, "did not register any span") {
+		span := tracer.FinishedSpans()[0]
+		assert.Equal(t, "1.2.3", span.Tag("client.version"), "header tag not set")
+		assert.Equal(t, "guest", span.Tag("session.kind"), "cookie tag not set")
+		assert.NotContains(t, span.Tags(), "missing", "empty tag should not be set")
+		assert.Equal(t, "acme", span.BaggageItem("tenant"), "query baggage not set")
+		if assert.Len(t, span.Logs(), 1, "invalid or missing log record") {
+			assert.Equal(t, "/orders", span.Logs()[0].Fields[0].ValueString, "invalid log value")
+		}
+	}
+}
+
+func TestTracingUpstreamBaggage(t *testing.T) {
+	tracer := mocktracer.New()
+	defer tracer.Reset()
+
+	logWatcher, logs := observer.New(zapcore.DebugLevel)
+	customLog := logging.LogGetter(func() (*zap.SugaredLogger, error) {
+		return zap.New(logWatcher).Sugar(), nil
+	})
+
+	var baggage map[string]string
+	handler := Traced(WithTracer(tracer))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		baggage = BaggageFromRequest(r)
+		logging.FromRequest(r).Info("handling request")
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler = logging.InContext(logging.WithLogger(customLog))(handler)
+
+	upstream := tracer.StartSpan("upstream")
+	upstream.SetBaggageItem("User-Id", "42")
+	req := httptest.NewRequest("GET", "/", nil)
+	err := tracer.Inject(upstream.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+	if assert.NoError(t, err, "error injecting tracing headers") {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Equal(t, map[string]string{"user-id": "42"}, baggage, "upstream baggage not exposed to handler")
+		if assert.Equal(t, 1, logs.Len(), "log not emitted to a custom logger") {
+			assert.Equal(t, "42", logs.All()[0].ContextMap()["baggage_user-id"], "baggage not added to the request logger")
+		}
+	}
+}
@@ -0,0 +1,26 @@
+// Package gorillanaming provides the span operation namer for the github.com/gorilla/mux router, kept apart from the
+// tracing package so it does not depend on the router.
+package gorillanaming
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/harnash/go-middlewares/tracing"
+)
+
+// MethodAndRoute names operations as "METHOD route-template" using the path template of the
+// github.com/gorilla/mux route that matched the request
+func MethodAndRoute(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+
+	return tracing.MethodAndTemplate(r.Method, template)
+}
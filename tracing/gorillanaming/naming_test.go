@@ -0,0 +1,33 @@
+package gorillanaming
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/harnash/go-middlewares/tracing"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestGorillaRouteNaming(t *testing.T) {
+	tracer := mocktracer.New()
+	defer tracer.Reset()
+
+	router := mux.NewRouter()
+	router.Use(mux.MiddlewareFunc(tracing.Traced(tracing.WithTracer(tracer), tracing.WithOperationNamer(MethodAndRoute))))
+	router.HandleFunc("/orders/{id}", okHandler)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/orders/1", nil))
+
+	spans := tracer.FinishedSpans()
+	if assert.Len(t, spans, 1, "did not register any span") {
+		assert.Equal(t, "DELETE /orders/{id}", spans[0].OperationName, "invalid operation name")
+	}
+	assert.Empty(t, MethodAndRoute(httptest.NewRequest("GET", "/", nil)), "unrouted request should not be named")
+}
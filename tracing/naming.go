@@ -0,0 +1,31 @@
+package tracing
+
+import (
+	"net/http"
+	"strings"
+)
+
+// OperationNamer is a function that derives span operation name from the request. Empty name means that the
+// namer cannot name a given request and the static name (see: WithName) should be used instead.
+type OperationNamer func(r *http.Request) string
+
+// MethodAndPattern names operations as "METHOD pattern" using the pattern of the http.ServeMux route that matched
+// the request (Go 1.22+). Handler needs to be registered in the http.ServeMux in order to see the pattern.
+func MethodAndPattern(r *http.Request) string {
+	return MethodAndTemplate(r.Method, r.Pattern)
+}
+
+// MethodAndTemplate joins request method and route template skipping the method if it is already a part of the
+// template (http.ServeMux patterns like "GET /items/{id}"). Empty template gives empty name. It is meant for the
+// namers of other routers (see: tracing/chinaming and tracing/gorillanaming packages).
+func MethodAndTemplate(method, template string) string {
+	if len(template) == 0 {
+		return ""
+	}
+
+	if strings.Contains(template, " ") {
+		return template
+	}
+
+	return method + " " + template
+}
@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestServeMuxPatternNaming(t *testing.T) {
+	tracer := mocktracer.New()
+	defer tracer.Reset()
+
+	traced := Traced(WithTracer(tracer), WithName("fallback"), WithOperationNamer(MethodAndPattern))
+	router := http.NewServeMux()
+	router.Handle("GET /items/{id}", traced(http.HandlerFunc(okHandler)))
+	router.Handle("/users/", traced(http.HandlerFunc(okHandler)))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items/42", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users/7", nil))
+	traced(http.HandlerFunc(okHandler)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/unrouted", nil))
+
+	spans := tracer.FinishedSpans()
+	if assert.Len(t, spans, 3, "not all spans were registered") {
+		assert.Equal(t, "GET /items/{id}", spans[0].OperationName, "invalid operation name for method pattern")
+		assert.Equal(t, "POST /users/", spans[1].OperationName, "invalid operation name for path pattern")
+		assert.Equal(t, "fallback", spans[2].OperationName, "static name not used as fallback")
+	}
+}
+
+func TestMethodAndTemplate(t *testing.T) {
+	assert.Equal(t, "GET /items/{id}", MethodAndTemplate("GET", "/items/{id}"), "method not added")
+	assert.Equal(t, "POST /items", MethodAndTemplate("GET", "POST /items"), "method should not be duplicated")
+	assert.Empty(t, MethodAndTemplate("GET", ""), "empty template should not be named")
+}
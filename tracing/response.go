@@ -0,0 +1,203 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harnash/go-middlewares"
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+const serverTimingKey key = 916
+
+// QueueTiming is the name of the "Server-Timing" metric holding the time the request spent in the queue of the
+// concurrency limiter (see: middlewares.RecordQueueWait)
+const QueueTiming = "queue"
+
+// TraceResponseHeader is the W3C Trace Context header used to return trace information to the client
+const TraceResponseHeader = "traceresponse"
+
+// WithTraceIDHeader will make the middleware return the trace ID to the client in a given response header
+// (e.g. "X-Trace-Id")
+func WithTraceIDHeader(header string) Option {
+	return func(o *options) {
+		o.traceIDHeader = header
+	}
+}
+
+// WithTraceResponse will make the middleware return trace information to the client in the "traceresponse" header
+func WithTraceResponse() Option {
+	return func(o *options) {
+		o.traceResponse = true
+	}
+}
+
+// WithServerTiming will make the middleware return durations of request phases to the client in the "Server-Timing"
+// header. Header is set right before the response headers are written. It holds the queue wait recorded by the
+// concurrency limiter placed after this one (see: middlewares.RecordQueueWait), the phases recorded by the handler
+// (see: StartPhase and AddTiming), the time spent in the wrapped handler without the queue wait ("handler") and the
+// total time ("total").
+func WithServerTiming() Option {
+	return func(o *options) {
+		o.serverTiming = true
+	}
+}
+
+// TraceIDFromRequest will return hex encoded trace ID of the span created by Traced for the given request
+func TraceIDFromRequest(r *http.Request) string {
+	return TraceIDFromContext(r.Context())
+}
+
+// TraceIDFromContext will return hex encoded trace ID of the span created by Traced from the given context.Context
+// Empty string is returned if there is no trace ID in the context.
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, ok := ctx.Value(traceIDKey).(jaeger.TraceID)
+	if !ok {
+		return ""
+	}
+	return traceID.String()
+}
+
+// StartPhase will start measuring a phase of the request handling. It creates a child span of the span found in the
+// context and records the duration for the "Server-Timing" header (see: WithServerTiming) once the returned
+// function is called.
+func StartPhase(ctx context.Context, name string) (finish func()) {
+	var span opentracing.Span
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		span = parent.Tracer().StartSpan(name, opentracing.ChildOf(parent.Context()))
+	}
+
+	timing, _ := ctx.Value(serverTimingKey).(*serverTiming)
+	started := time.Now()
+
+	return func() {
+		if span != nil {
+			span.Finish()
+		}
+		if timing != nil {
+			timing.add(name, time.Since(started))
+		}
+	}
+}
+
+// AddTiming will record the duration of an already measured request phase for the "Server-Timing" header
+func AddTiming(ctx context.Context, name string, duration time.Duration) {
+	if timing, ok := ctx.Value(serverTimingKey).(*serverTiming); ok {
+		timing.add(name, duration)
+	}
+}
+
+// traceResponse formats the "traceresponse" header value for the given span context
+func traceResponse(sc jaeger.SpanContext) string {
+	flags := "00"
+	if sc.IsSampled() {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%016x%016x-%016x-%s", sc.TraceID().High, sc.TraceID().Low, uint64(sc.SpanID()), flags)
+}
+
+type timingEntry struct {
+	name     string
+	duration time.Duration
+}
+
+// serverTiming collects durations of the request phases
+type serverTiming struct {
+	lock           sync.Mutex
+	started        time.Time
+	handlerStarted time.Time
+	queue          *middlewares.QueueWait
+	entries        []timingEntry
+}
+
+func (t *serverTiming) add(name string, duration time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.entries = append(t.entries, timingEntry{name: name, duration: duration})
+}
+
+// header formats the "Server-Timing" header value with the queue wait, all recorded phases, the time spent in the
+// handler and the total time spent so far
+func (t *serverTiming) header() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	metrics := make([]string, 0, len(t.entries)+3)
+	var queued time.Duration
+	if t.queue != nil {
+		if d, ok := t.queue.Get(); ok {
+			queued = d
+			metrics = append(metrics, QueueTiming+";dur="+formatMillis(d))
+		}
+	}
+	for _, entry := range t.entries {
+		metrics = append(metrics, entry.name+";dur="+formatMillis(entry.duration))
+	}
+	if !t.handlerStarted.IsZero() {
+		// the queue wait is reported separately
+		metrics = append(metrics, "handler;dur="+formatMillis(max(time.Since(t.handlerStarted)-queued, 0)))
+	}
+	metrics = append(metrics, "total;dur="+formatMillis(time.Since(t.started)))
+
+	return strings.Join(metrics, ", ")
+}
+
+func formatMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// timingWriter sets the "Server-Timing" header right before the response headers are written
+type timingWriter struct {
+	http.ResponseWriter
+	timing  *serverTiming
+	written bool
+}
+
+func (tw *timingWriter) writeTiming() {
+	if !tw.written {
+		tw.written = true
+		tw.Header().Set("Server-Timing", tw.timing.header())
+	}
+}
+
+// WriteHeader implements net/http.ResponseWriter's WriteHeader()
+func (tw *timingWriter) WriteHeader(code int) {
+	// informational responses (e.g. 103 Early Hints) are followed by the final response headers
+	if code >= 200 || code == http.StatusSwitchingProtocols {
+		tw.writeTiming()
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements net/http.ResponseWriter's Write()
+func (tw *timingWriter) Write(b []byte) (int, error) {
+	tw.writeTiming()
+	return tw.ResponseWriter.Write(b)
+}
+
+// Flush implements net/http.Flusher interface
+func (tw *timingWriter) Flush() {
+	tw.writeTiming()
+	if flusher, ok := tw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements net/http.Hijacker interface
+func (tw *timingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.written = true
+	return http.NewResponseController(tw.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the original http.ResponseWriter (used by net/http.ResponseController)
+func (tw *timingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
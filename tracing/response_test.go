@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/harnash/go-middlewares"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestTraceIDResponseHeaders(t *testing.T) {
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+
+	var traceID string
+	handler := Traced(WithTracer(tracer), WithTraceIDHeader("X-Trace-Id"), WithTraceResponse())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID = TraceIDFromRequest(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+
+	if assert.NotEmpty(t, traceID, "trace ID not available in the request context") {
+		assert.Equal(t, traceID, response.Header().Get("X-Trace-Id"), "trace ID not returned to the client")
+		assert.Regexp(t, regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`), response.Header().Get("traceresponse"), "invalid traceresponse header")
+		assert.Contains(t, response.Header().Get("traceresponse"), fmt.Sprintf("%032s", traceID), "traceresponse does not contain the trace ID")
+	}
+}
+
+func TestServerTiming(t *testing.T) {
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+
+	handler := Traced(WithTracer(tracer), WithServerTiming())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		finish := StartPhase(r.Context(), "db")
+		time.Sleep(time.Millisecond)
+		finish()
+		AddTiming(r.Context(), "cache", 2*time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+		AddTiming(r.Context(), "late", time.Millisecond)
+	}))
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+
+	timing := response.Header().Get("Server-Timing")
+	assert.Regexp(t, regexp.MustCompile(`^db;dur=\d+\.\d{3}, cache;dur=2\.000, handler;dur=\d+\.\d{3}, total;dur=\d+\.\d{3}$`), timing, "invalid Server-Timing header")
+
+	// handlers that do not write anything also get the header
+	silent := Traced(WithTracer(tracer), WithServerTiming())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	response = httptest.NewRecorder()
+	silent.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Regexp(t, regexp.MustCompile(`^handler;dur=\d+\.\d{3}, total;dur=\d+\.\d{3}$`), response.Header().Get("Server-Timing"), "invalid Server-Timing header")
+
+	// queue wait recorded by the concurrency limiter is not a part of the handler phase
+	queued := Traced(WithTracer(tracer), WithServerTiming())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middlewares.RecordQueueWait(r.Context(), time.Hour)
+	}))
+	response = httptest.NewRecorder()
+	queued.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Regexp(t, regexp.MustCompile(`^queue;dur=3600000\.000, handler;dur=0\.000, total;dur=\d+\.\d{3}$`), response.Header().Get("Server-Timing"), "invalid Server-Timing header")
+
+	// queue wait recorded before the middleware is not reported
+	ctx, _ := middlewares.WithQueueWait(context.Background())
+	middlewares.RecordQueueWait(ctx, time.Hour)
+	response = httptest.NewRecorder()
+	silent.ServeHTTP(response, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	assert.Regexp(t, regexp.MustCompile(`^handler;dur=\d+\.\d{3}, total;dur=\d+\.\d{3}$`), response.Header().Get("Server-Timing"), "invalid Server-Timing header")
+}
@@ -0,0 +1,205 @@
+package tracing
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+)
+
+const samplingDecisionKey key = 915
+
+// SamplingDecision defines what should happen with the span created for a request
+type SamplingDecision int
+
+const (
+	// SamplingDefault leaves the sampling decision to the tracer
+	SamplingDefault SamplingDecision = iota
+	// SamplingForce forces the span to be sampled
+	SamplingForce
+	// SamplingDrop prevents the span from being sampled
+	SamplingDrop
+)
+
+// String returns human readable representation of the decision
+func (d SamplingDecision) String() string {
+	switch d {
+	case SamplingForce:
+		return "force"
+	case SamplingDrop:
+		return "drop"
+	default:
+		return "default"
+	}
+}
+
+// SamplingPolicy evaluates the request before the span is started and decides whether it should be sampled
+type SamplingPolicy func(r *http.Request) SamplingDecision
+
+// WithSamplingPolicy sets the policy used by the middleware to make sampling decisions
+func WithSamplingPolicy(policy SamplingPolicy) Option {
+	return func(o *options) {
+		o.sampling = policy
+	}
+}
+
+// SamplingDecisionFromRequest will return the sampling decision made by Traced for the given request
+func SamplingDecisionFromRequest(r *http.Request) SamplingDecision {
+	return SamplingDecisionFromContext(r.Context())
+}
+
+// SamplingDecisionFromContext will return the sampling decision made by Traced from the given context.Context
+func SamplingDecisionFromContext(ctx context.Context) SamplingDecision {
+	decision, ok := ctx.Value(samplingDecisionKey).(SamplingDecision)
+	if !ok {
+		return SamplingDefault
+	}
+	return decision
+}
+
+// FirstOf combines policies and returns the first decision other than SamplingDefault
+func FirstOf(policies ...SamplingPolicy) SamplingPolicy {
+	return func(r *http.Request) SamplingDecision {
+		for _, policy := range policies {
+			if decision := policy(r); decision != SamplingDefault {
+				return decision
+			}
+		}
+		return SamplingDefault
+	}
+}
+
+// ForceOnHeader forces sampling of requests with a non-empty given header (e.g. "X-Debug")
+func ForceOnHeader(header string) SamplingPolicy {
+	header = http.CanonicalHeaderKey(header)
+	return func(r *http.Request) SamplingDecision {
+		if len(r.Header.Get(header)) > 0 {
+			return SamplingForce
+		}
+		return SamplingDefault
+	}
+}
+
+// JaegerDebug forces sampling of requests carrying the Jaeger debug header ("jaeger-debug-id")
+func JaegerDebug() SamplingPolicy {
+	return ForceOnHeader(jaeger.JaegerDebugHeader)
+}
+
+// DropPaths never samples requests for the given URL paths (e.g. health checks)
+func DropPaths(paths ...string) SamplingPolicy {
+	dropped := map[string]struct{}{}
+	for _, path := range paths {
+		dropped[path] = struct{}{}
+	}
+
+	return func(r *http.Request) SamplingDecision {
+		if _, ok := dropped[r.URL.Path]; ok {
+			return SamplingDrop
+		}
+		return SamplingDefault
+	}
+}
+
+// Ratio samples given fraction (0.0 - 1.0) of requests
+func Ratio(ratio float64) SamplingPolicy {
+	return func(r *http.Request) SamplingDecision {
+		if rand.Float64() < ratio {
+			return SamplingForce
+		}
+		return SamplingDrop
+	}
+}
+
+// PerRoute applies different policies to routes named by the namer. Requests for other routes are evaluated
+// with the fallback policy (if any).
+func PerRoute(namer OperationNamer, policies map[string]SamplingPolicy, fallback SamplingPolicy) SamplingPolicy {
+	return func(r *http.Request) SamplingDecision {
+		if policy, ok := policies[namer(r)]; ok {
+			return policy(r)
+		}
+		if fallback != nil {
+			return fallback(r)
+		}
+		return SamplingDefault
+	}
+}
+
+// maxSamplingRoutes limits the number of routes rate limited separately by RateLimited
+const maxSamplingRoutes = 1000
+
+// otherSamplingRoute is the route sharing the rate limit of all the routes above maxSamplingRoutes
+const otherSamplingRoute = "other"
+
+// RateLimited samples at most perSecond requests per second for each route named by the namer (URL path if nil).
+// At most 1000 routes are limited separately, requests for unseen routes above the limit share a single limit so
+// a namer returning the route patterns (eg. MethodAndPattern) should be used to keep them apart.
+func RateLimited(perSecond float64, namer OperationNamer) SamplingPolicy {
+	if namer == nil {
+		namer = func(r *http.Request) string { return r.URL.Path }
+	}
+
+	var lock sync.Mutex
+	buckets := map[string]*samplingBucket{}
+
+	return func(r *http.Request) SamplingDecision {
+		route := namer(r)
+		now := time.Now()
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		bucket, ok := buckets[route]
+		if !ok && len(buckets) >= maxSamplingRoutes {
+			route = otherSamplingRoute
+			bucket, ok = buckets[route]
+		}
+		if !ok {
+			bucket = &samplingBucket{tokens: 1, updated: now}
+			buckets[route] = bucket
+		}
+
+		if bucket.take(now, perSecond) {
+			return SamplingForce
+		}
+		return SamplingDrop
+	}
+}
+
+// samplingBucket is a token bucket with capacity of a single token
+type samplingBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills the bucket and returns true if a token was available
+func (b *samplingBucket) take(now time.Time, perSecond float64) bool {
+	b.tokens += now.Sub(b.updated).Seconds() * perSecond
+	if b.tokens > 1 {
+		b.tokens = 1
+	}
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// applySampling enforces the sampling decision on the span
+func applySampling(span opentracing.Span, decision SamplingDecision, r *http.Request) {
+	switch decision {
+	case SamplingForce:
+		ext.SamplingPriority.Set(span, 1)
+		if debugID := r.Header.Get(jaeger.JaegerDebugHeader); len(debugID) > 0 {
+			span.SetTag(jaeger.JaegerDebugHeader, debugID)
+		}
+	case SamplingDrop:
+		ext.SamplingPriority.Set(span, 0)
+	}
+}
@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplingPolicy(t *testing.T) {
+	tracer := mocktracer.New()
+	defer tracer.Reset()
+
+	var decisions []SamplingDecision
+	policy := FirstOf(JaegerDebug(), ForceOnHeader("X-Debug"), DropPaths("/healthz"))
+	handler := Traced(WithTracer(tracer), WithSamplingPolicy(policy))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decisions = append(decisions, SamplingDecisionFromRequest(r))
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	debug := httptest.NewRequest("GET", "/healthz", nil)
+	debug.Header.Set("jaeger-debug-id", "support-ticket-1")
+	forced := httptest.NewRequest("GET", "/orders", nil)
+	forced.Header.Set("X-Debug", "1")
+
+	for _, req := range []*http.Request{debug, forced, httptest.NewRequest("GET", "/healthz", nil), httptest.NewRequest("GET", "/orders", nil)} {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, []SamplingDecision{SamplingForce, SamplingForce, SamplingDrop, SamplingDefault}, decisions, "invalid sampling decisions")
+	spans := tracer.FinishedSpans()
+	if assert.Len(t, spans, 4, "not all spans were registered") {
+		assert.True(t, spans[0].SpanContext.Sampled, "debug request not sampled")
+		assert.Equal(t, "support-ticket-1", spans[0].Tag("jaeger-debug-id"), "debug id not recorded")
+		assert.True(t, spans[1].SpanContext.Sampled, "forced request not sampled")
+		assert.False(t, spans[2].SpanContext.Sampled, "health check sampled")
+		assert.True(t, spans[3].SpanContext.Sampled, "default decision should be left to the tracer")
+	}
+}
+
+func TestRateLimitedSampling(t *testing.T) {
+	policy := PerRoute(MethodAndPattern, map[string]SamplingPolicy{
+		"GET /limited": RateLimited(0.001, MethodAndPattern),
+		"GET /never":   Ratio(0),
+	}, Ratio(1))
+
+	router := http.NewServeMux()
+	var decisions []SamplingDecision
+	record := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decisions = append(decisions, policy(r))
+	})
+	router.Handle("GET /limited", record)
+	router.Handle("GET /never", record)
+	router.Handle("GET /other", record)
+
+	for _, path := range []string{"/limited", "/limited", "/never", "/other"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	assert.Equal(t, []SamplingDecision{SamplingForce, SamplingDrop, SamplingDrop, SamplingForce}, decisions, "invalid sampling decisions")
+}
+
+func TestRateLimitedSamplingRoutes(t *testing.T) {
+	policy := RateLimited(0.001, nil)
+	for i := 0; i < maxSamplingRoutes; i++ {
+		path := "/" + strconv.Itoa(i)
+		assert.Equal(t, SamplingForce, policy(httptest.NewRequest("GET", path, nil)), "route should be limited separately")
+	}
+
+	assert.Equal(t, SamplingForce, policy(httptest.NewRequest("GET", "/random-1", nil)),
+		"first unseen route should be sampled")
+	assert.Equal(t, SamplingDrop, policy(httptest.NewRequest("GET", "/random-2", nil)),
+		"unseen routes should share the limit")
+	assert.Equal(t, SamplingDrop, policy(httptest.NewRequest("GET", "/0", nil)), "seen route should keep its limit")
+}
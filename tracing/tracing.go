@@ -5,8 +5,10 @@ import (
 	"net/http"
 	"reflect"
 	"runtime"
+	"time"
 
 	"github.com/harnash/go-middlewares"
+	"github.com/harnash/go-middlewares/realip"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
@@ -24,6 +26,15 @@ type options struct {
 	logs          map[stringLogName]string
 	handlerPrefix string
 	handlerName   string
+	namer         OperationNamer
+	sampling      SamplingPolicy
+	traceIDHeader string
+	traceResponse bool
+	serverTiming  bool
+
+	baggageExtractors []Extractor
+	tagExtractors     []Extractor
+	logExtractors     []Extractor
 }
 
 // Option represents a logger option.
@@ -65,6 +76,14 @@ func WithName(name string) Option {
 	}
 }
 
+// WithOperationNamer will derive the span operation name from each request using the given namer. Static name
+// (see: WithName) is used for requests that the namer cannot name.
+func WithOperationNamer(namer OperationNamer) Option {
+	return func(o *options) {
+		o.namer = namer
+	}
+}
+
 // WithNamePrefix will define prefix for a operation name that is being created by middleware
 func WithNamePrefix(prefix string) Option {
 	return func(o *options) {
@@ -111,6 +130,17 @@ func newTracingOptions(opts ...Option) *options {
 	return cfg
 }
 
+// operationName returns the span operation name for a given request
+func (o *options) operationName(r *http.Request) string {
+	if o.namer != nil {
+		if name := o.namer(r); len(name) > 0 {
+			return o.handlerPrefix + name
+		}
+	}
+
+	return o.handlerPrefix + o.handlerName
+}
+
 // Traced is a middleware that adds OpenTracing spans to the current request context and sets some sane span tags
 func Traced(options ...Option) middlewares.Middleware {
 	fn := func(h http.Handler) http.Handler {
@@ -120,38 +150,75 @@ func Traced(options ...Option) middlewares.Middleware {
 		}
 
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started := time.Now()
 			var span opentracing.Span
 
+			decision := SamplingDefault
+			if o.sampling != nil {
+				decision = o.sampling(r)
+			}
+
+			operationName := o.operationName(r)
 			spanCtx, err := o.tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
 
 			if err != nil {
-				span = o.tracer.StartSpan(o.handlerPrefix + o.handlerName)
+				span = o.tracer.StartSpan(operationName)
 			} else {
-				span = o.tracer.StartSpan(o.handlerPrefix+o.handlerName, ext.RPCServerOption(spanCtx))
+				span = o.tracer.StartSpan(operationName, ext.RPCServerOption(spanCtx))
 			}
+			applySampling(span, decision, r)
 
 			ext.HTTPMethod.Set(span, r.Method)
 			ext.HTTPUrl.Set(span, r.URL.Path)
-
-			for key, val := range o.baggage {
-				key.Set(span, val)
+			if addr := realip.FromRequest(r); addr.Is4() {
+				ext.PeerHostIPv4.SetString(span, addr.String())
+			} else if addr.Is6() {
+				ext.PeerHostIPv6.Set(span, addr.String())
 			}
 
-			for key, val := range o.tags {
-				key.Set(span, val)
-			}
-
-			for key, val := range o.logs {
-				key.Set(span, val)
-			}
+			o.decorate(span, r)
 
 			defer span.Finish()
 
 			if sc, ok := span.Context().(jaeger.SpanContext); ok {
 				r = r.WithContext(context.WithValue(r.Context(), traceIDKey, sc.TraceID()))
+				if len(o.traceIDHeader) > 0 {
+					w.Header().Set(o.traceIDHeader, sc.TraceID().String())
+				}
+				if o.traceResponse {
+					w.Header().Set(TraceResponseHeader, traceResponse(sc))
+				}
 			}
 
-			h.ServeHTTP(w, r.WithContext(opentracing.ContextWithSpan(r.Context(), span)))
+			ctx := context.WithValue(exposeBaggage(r.Context(), span), samplingDecisionKey, decision)
+			var timing *serverTiming
+			if o.serverTiming {
+				timing = &serverTiming{started: started}
+				var queue *middlewares.QueueWait
+				ctx, queue = middlewares.WithQueueWait(ctx)
+				// queue wait recorded before this middleware is not a part of the handler phase
+				if _, recorded := queue.Get(); !recorded {
+					timing.queue = queue
+				}
+				ctx = context.WithValue(ctx, serverTimingKey, timing)
+				tw := &timingWriter{ResponseWriter: w, timing: timing}
+				// handler might not write anything and leave it to the net/http server
+				defer tw.writeTiming()
+				w = tw
+			}
+
+			r = r.WithContext(opentracing.ContextWithSpan(ctx, span))
+			if timing != nil {
+				timing.handlerStarted = time.Now()
+			}
+			h.ServeHTTP(w, r)
+
+			// some routers (e.g. chi) know the complete route only after the request has been routed
+			if o.namer != nil {
+				if name := o.operationName(r); name != operationName {
+					span.SetOperationName(name)
+				}
+			}
 		})
 	}
 
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/harnash/go-middlewares/http_metrics"
+	"github.com/harnash/go-middlewares/realip"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/prometheus/client_golang/prometheus"
@@ -128,6 +129,29 @@ func TestTracingLogging(t *testing.T) {
 	}
 }
 
+func TestTracingPeer(t *testing.T) {
+	tracer := mocktracer.New()
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := Traced(WithTracer(tracer), WithName("tests"))(testHandler)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:51234"
+	r.Header.Set(realip.ForwardedForHeader, "192.0.2.10")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	realip.Resolved(realip.WithTrustedProxies("10.0.0.0/8"))(handler).ServeHTTP(httptest.NewRecorder(), r)
+	r.RemoteAddr = "[2001:db8::17]:51234"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if spans := tracer.FinishedSpans(); assert.Len(t, spans, 3, "did not register spans") {
+		assert.Equal(t, "10.0.0.1", spans[0].Tag("peer.ipv4"), "connection address should be tagged")
+		assert.Equal(t, "192.0.2.10", spans[1].Tag("peer.ipv4"), "resolved client IP should be tagged")
+		assert.Equal(t, "2001:db8::17", spans[2].Tag("peer.ipv6"), "IPv6 address should be tagged")
+		assert.Nil(t, spans[2].Tag("peer.ipv4"), "IPv6 address should not be tagged as IPv4")
+	}
+}
+
 func TestTracingTag(t *testing.T) {
 	tracer := mocktracer.New()
 	err := http_metrics.RegisterDefaultMetrics(prometheus.DefaultRegisterer)
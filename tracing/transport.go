@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+const (
+	operationNameKey key = 912
+	retryCounterKey  key = 913
+)
+
+// ErrServerOption is the panic value of NewTransport if it is given an option that only applies to Traced (sampling,
+// trace ID response header, trace response or Server-Timing header)
+var ErrServerOption = errors.New("tracing: option is not supported by the client transport")
+
+// Transport is an http.RoundTripper that creates client spans for outgoing requests. Spans are created as children
+// of the span found in the request's context (see: Traced) and span context is propagated to the downstream
+// service using HTTP headers, the same way Traced extracts it.
+type Transport struct {
+	base    http.RoundTripper
+	options *options
+}
+
+// NewTransport will wrap given http.RoundTripper (http.DefaultTransport if nil) with a tracing Transport.
+// Options configuring the tracer, operation name, tags, baggage and logs (including their request-derived
+// variants) are supported. Server-only options (WithSamplingPolicy, WithTraceIDHeader, WithTraceResponse and
+// WithServerTiming) make NewTransport panic with ErrServerOption.
+// If the tracer is not specified opentracing.GlobalTracer() is used.
+func NewTransport(base http.RoundTripper, options ...Option) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	cfg := newTracingOptions(options...)
+	if cfg.sampling != nil || len(cfg.traceIDHeader) > 0 || cfg.traceResponse || cfg.serverTiming {
+		panic(ErrServerOption)
+	}
+
+	return &Transport{base: base, options: cfg}
+}
+
+// WithOperationName returns a copy of the context that will make Transport use the given name as the operation
+// name of the client span created for requests carrying that context
+func WithOperationName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, operationNameKey, name)
+}
+
+// WithRetryTracking returns a copy of the context in which Transport will count the attempts made with requests
+// carrying that context. Every span created after the first attempt is tagged as a retry.
+func WithRetryTracking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryCounterKey, new(int32))
+}
+
+// RoundTrip implements net/http.RoundTripper interface
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	tracer := t.options.tracer
+	if tracer == nil {
+		tracer = opentracing.GlobalTracer()
+	}
+
+	spanOptions := []opentracing.StartSpanOption{ext.SpanKindRPCClient}
+	if parent := opentracing.SpanFromContext(r.Context()); parent != nil {
+		spanOptions = append(spanOptions, opentracing.ChildOf(parent.Context()))
+	}
+
+	span := tracer.StartSpan(t.operationName(r), spanOptions...)
+	defer span.Finish()
+
+	ext.HTTPMethod.Set(span, r.Method)
+	ext.HTTPUrl.Set(span, r.URL.String())
+	ext.PeerHostname.Set(span, r.URL.Hostname())
+
+	if counter, ok := r.Context().Value(retryCounterKey).(*int32); ok {
+		attempt := atomic.AddInt32(counter, 1)
+		span.SetTag("http.attempt", attempt)
+		if attempt > 1 {
+			span.SetTag("http.retry", true)
+		}
+	}
+
+	t.options.decorate(span, r)
+
+	// RoundTripper must not modify the original request so the headers are injected into a copy
+	outgoing := r.Clone(opentracing.ContextWithSpan(r.Context(), span))
+	if err := tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(outgoing.Header)); err != nil {
+		span.LogKV("event", "error", "message", "could not inject span context", "error.object", err)
+	}
+
+	resp, err := t.base.RoundTrip(outgoing)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("event", "error", "error.object", err)
+		return resp, err
+	}
+
+	ext.HTTPStatusCode.Set(span, uint16(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		ext.Error.Set(span, true)
+	}
+
+	return resp, nil
+}
+
+// operationName returns the name of the client span for a given request
+func (t *Transport) operationName(r *http.Request) string {
+	if name, ok := r.Context().Value(operationNameKey).(string); ok && len(name) > 0 {
+		return t.options.handlerPrefix + name
+	}
+
+	name := t.options.handlerName
+	if t.options.namer != nil {
+		if derived := t.options.namer(r); len(derived) > 0 {
+			name = derived
+		}
+	}
+
+	if len(name) == 0 {
+		name = "HTTP " + r.Method
+	}
+
+	return t.options.handlerPrefix + name
+}
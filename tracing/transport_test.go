@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestTransportPropagation(t *testing.T) {
+	tracer := mocktracer.New()
+	defer tracer.Reset()
+
+	downstream := Traced(WithTracer(tracer), WithName("downstream"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	srv := httptest.NewServer(downstream)
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewTransport(srv.Client().Transport, WithTracer(tracer))}
+
+	parent := tracer.StartSpan("parent")
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if assert.NoError(t, err, "could not create client request") {
+		req = req.WithContext(opentracing.ContextWithSpan(req.Context(), parent))
+		resp, err := client.Do(req)
+		parent.Finish()
+		if assert.NoError(t, err, "error making HTTP request") {
+			assert.Equal(t, http.StatusAccepted, resp.StatusCode, "invalid HTTP status code")
+			assert.Empty(t, req.Header.Get("Mockpfx-Ids-Traceid"), "original request should not be modified")
+
+			spans := tracer.FinishedSpans()
+			if assert.Len(t, spans, 3, "not all spans were registered") {
+				server, clientSpan := spans[0], spans[1]
+				assert.Equal(t, "downstream", server.OperationName, "server span not found")
+				assert.Equal(t, "HTTP GET", clientSpan.OperationName, "client span not found")
+				assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, clientSpan.ParentID, "client span is not a child of request span")
+				assert.Equal(t, clientSpan.SpanContext.SpanID, server.ParentID, "span context not propagated downstream")
+				assert.Equal(t, uint16(http.StatusAccepted), clientSpan.Tag("http.status_code"), "status code not recorded")
+				assert.Equal(t, ext.SpanKindRPCClientEnum, clientSpan.Tag("span.kind"), "invalid span kind")
+			}
+		}
+	}
+}
+
+func TestTransportErrorsAndRetries(t *testing.T) {
+	tracer := mocktracer.New()
+	defer tracer.Reset()
+
+	client := &http.Client{Transport: NewTransport(failingTransport{}, WithTracer(tracer), WithNamePrefix("client_"))}
+
+	req, err := http.NewRequest("GET", "http://example.invalid/", nil)
+	if assert.NoError(t, err, "could not create client request") {
+		ctx := WithRetryTracking(WithOperationName(req.Context(), "fetch_example"))
+		req = req.WithContext(ctx)
+		for i := 0; i < 2; i++ {
+			_, err = client.Do(req)
+			assert.Error(t, err, "transport error not returned")
+		}
+
+		spans := tracer.FinishedSpans()
+		if assert.Len(t, spans, 2, "not all spans were registered") {
+			assert.Equal(t, "client_fetch_example", spans[0].OperationName, "per-request operation name not used")
+			assert.Equal(t, true, spans[0].Tag("error"), "error not recorded")
+			assert.Equal(t, int32(1), spans[0].Tag("http.attempt"), "invalid attempt number")
+			assert.Nil(t, spans[0].Tag("http.retry"), "first attempt marked as retry")
+			assert.Equal(t, int32(2), spans[1].Tag("http.attempt"), "invalid attempt number")
+			assert.Equal(t, true, spans[1].Tag("http.retry"), "retry not recorded")
+		}
+	}
+}
+
+func TestTransportServerOptions(t *testing.T) {
+	sampled := func(*http.Request) SamplingDecision { return SamplingDecision(0) }
+	for name, option := range map[string]Option{
+		"sampling":        WithSamplingPolicy(sampled),
+		"trace ID header": WithTraceIDHeader("X-Trace-Id"),
+		"trace response":  WithTraceResponse(),
+		"server timing":   WithServerTiming(),
+	} {
+		assert.PanicsWithValue(t, ErrServerOption, func() { NewTransport(nil, option) }, "%s option not rejected", name)
+	}
+	assert.NotPanics(t, func() { NewTransport(nil, WithName("client"), WithNamePrefix("http_")) }, "client options rejected")
+}